@@ -0,0 +1,167 @@
+// Package audit records who changed what through a management manager.
+// Every record is chained to the previous one by its hash, so records
+// removed or altered after the fact are detected by Verify.
+//
+//	sink, _ := audit.NewFileSink("/var/log/gi/audit.ndjson")
+//	manager := audit.New(managementManager, audit.NewLog(sink, sink.Last()), audit.Options{})
+//	manager.WithContext(audit.NewContext(r.Context(), actor)).AddUserRoles(email, "admin")
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Results of a record.
+const (
+	Success = "success"
+	Failure = "failure"
+)
+
+// Record is an audited call.
+type Record struct {
+	Sequence  uint64    `json:"seq"`
+	Time      time.Time `json:"time"`
+	Actor     string    `json:"actor"`
+	Operation string    `json:"operation"`
+	// Target is the email of the user the call was about, if any.
+	Target string `json:"target,omitempty"`
+	// RolesBefore and RolesAfter are the active roles of the target around
+	// a write. RolesBefore is read before the call and RolesAfter derived
+	// from it and the call, since reading again may be answered by a read
+	// started before the write. Both are null when they could not be read.
+	RolesBefore []string `json:"rolesBefore"`
+	RolesAfter  []string `json:"rolesAfter"`
+	Result      string   `json:"result"`
+	Error       string   `json:"error,omitempty"`
+	// PreviousHash is the hash of the record before this one, empty for the
+	// first record.
+	PreviousHash string `json:"prevHash"`
+	Hash         string `json:"hash"`
+}
+
+// hash returns the hash of the record, computed over its JSON encoding
+// without the hash itself.
+func (r Record) hash() string {
+	r.Hash = ""
+	data, _ := json.Marshal(r)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ChainError reports the first record breaking the chain.
+type ChainError struct {
+	Sequence uint64
+	Reason   string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("audit: record %d: %s", e.Sequence, e.Reason)
+}
+
+// Verify checks that every record carries its own hash and the hash of the
+// record before it, the first record starting the chain.
+func Verify(records []Record) error {
+	return VerifyAfter(Record{}, records)
+}
+
+// VerifyAfter checks records like Verify, the first record continuing the
+// chain from previous, a record already verified.
+func VerifyAfter(previous Record, records []Record) error {
+	for _, record := range records {
+		if record.Hash != record.hash() {
+			return &ChainError{Sequence: record.Sequence, Reason: "hash mismatch"}
+		}
+		if record.Sequence != previous.Sequence+1 && previous.Sequence == 0 {
+			return &ChainError{Sequence: record.Sequence, Reason: "does not start the chain"}
+		}
+		if record.Sequence != previous.Sequence+1 {
+			return &ChainError{Sequence: record.Sequence, Reason: fmt.Sprintf("follows record %d", previous.Sequence)}
+		}
+		if record.PreviousHash != previous.Hash {
+			return &ChainError{Sequence: record.Sequence, Reason: "previous hash mismatch"}
+		}
+		previous = record
+	}
+	return nil
+}
+
+// ReadRecords decodes the records of an NDJSON stream, such as a file
+// written by a FileSink.
+func ReadRecords(r io.Reader) ([]Record, error) {
+	var records []Record
+	decoder := json.NewDecoder(r)
+	for {
+		var record Record
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+}
+
+// Log chains records and writes them to a sink.
+type Log struct {
+	sink Sink
+	now  func() time.Time
+
+	mutex    sync.Mutex
+	sequence uint64
+	last     string
+}
+
+// NewLog returns a log writing to sink. When previous is not nil, the chain
+// continues from it, as after a restart.
+func NewLog(sink Sink, previous *Record) *Log {
+	l := &Log{sink: sink, now: time.Now}
+	if previous != nil {
+		l.sequence = previous.Sequence
+		l.last = previous.Hash
+	}
+	return l
+}
+
+// Append chains the record and writes it. The chain advances even when the
+// sink fails, so a lost record shows as a gap when verifying.
+func (l *Log) Append(record Record) (*Record, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if record.Time.IsZero() {
+		record.Time = l.now()
+	}
+	record.Time = record.Time.UTC()
+	record.Sequence = l.sequence + 1
+	record.PreviousHash = l.last
+	record.Hash = record.hash()
+
+	l.sequence = record.Sequence
+	l.last = record.Hash
+	return &record, l.sink.Write(&record)
+}
+
+type actorKey struct{}
+
+// NewContext returns a copy of ctx carrying the actor recorded for calls
+// made with it.
+func NewContext(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor stored in ctx by NewContext, or an empty
+// string. The user key of an authorization stored in ctx is not used, since
+// it may come from a cookie; the actor must be resolved server-side.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
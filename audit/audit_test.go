@@ -0,0 +1,278 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stone-payments/globalidentity-go/management"
+	"github.com/stone-payments/globalidentity-go/management/managementtest"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ management.Manager = &Manager{}
+
+type memorySink struct {
+	records []Record
+	err     error
+}
+
+func (s *memorySink) Write(record *Record) error {
+	s.records = append(s.records, *record)
+	return s.err
+}
+
+func newManager(options Options) (*Manager, *memorySink, *managementtest.Manager) {
+	users := managementtest.New(core.User{Email: "user@test.com", Roles: []string{"viewer"}})
+	sink := &memorySink{}
+	log := NewLog(sink, nil)
+	log.now = func() time.Time { return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC) }
+	return New(users, log, options), sink, users
+}
+
+func TestManagerRecordsWrites(t *testing.T) {
+	manager, sink, _ := newManager(Options{})
+	ctx := NewContext(context.Background(), "admin@test.com")
+
+	assert.Nil(t, manager.WithContext(ctx).AddUserRoles("user@test.com", "admin"))
+	_, err := manager.User("user@test.com", true)
+	assert.Nil(t, err)
+
+	assert.Len(t, sink.records, 1)
+	record := sink.records[0]
+	assert.Equal(t, uint64(1), record.Sequence)
+	assert.Equal(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), record.Time)
+	assert.Equal(t, "admin@test.com", record.Actor)
+	assert.Equal(t, AddUserRoles, record.Operation)
+	assert.Equal(t, "user@test.com", record.Target)
+	assert.Equal(t, []string{"viewer"}, record.RolesBefore)
+	assert.Equal(t, []string{"admin", "viewer"}, record.RolesAfter)
+	assert.Equal(t, Success, record.Result)
+	assert.Equal(t, "", record.PreviousHash)
+	assert.NotEmpty(t, record.Hash)
+}
+
+func TestManagerRecordsCreateAndFailures(t *testing.T) {
+	manager, sink, users := newManager(Options{})
+	audited := manager.WithContext(NewContext(context.Background(), "admin-key"))
+
+	_, err := audited.CreateUser(core.User{Email: "new@test.com", Roles: []string{"admin"}}, "secret")
+	assert.Nil(t, err)
+
+	failure := errors.New("unavailable")
+	users.Fail("RemoveUserRoles", failure)
+	assert.Equal(t, failure, audited.RemoveUserRoles("user@test.com", "viewer"))
+
+	users.Fail("UserRoles", failure)
+	_, err = audited.UpdateUser(core.User{Email: "user@test.com", Name: "User"})
+	assert.Nil(t, err)
+
+	assert.Len(t, sink.records, 3)
+	created, removed, updated := sink.records[0], sink.records[1], sink.records[2]
+	assert.Equal(t, "admin-key", created.Actor)
+	assert.Equal(t, CreateUser, created.Operation)
+	assert.Equal(t, []string{}, created.RolesBefore)
+	assert.Equal(t, []string{"admin"}, created.RolesAfter)
+	assert.NotContains(t, created.Error, "secret")
+
+	assert.Equal(t, Failure, removed.Result)
+	assert.Equal(t, "unavailable", removed.Error)
+	assert.Equal(t, []string{"viewer"}, removed.RolesBefore)
+	assert.Equal(t, []string{"viewer"}, removed.RolesAfter, "a failed write changes nothing")
+
+	assert.Equal(t, Success, updated.Result)
+	assert.Nil(t, updated.RolesBefore, "roles that cannot be read are null")
+	assert.Nil(t, updated.RolesAfter)
+
+	assert.Nil(t, Verify(sink.records))
+}
+
+func TestManagerRecordsRequestedChange(t *testing.T) {
+	manager, sink, users := newManager(Options{})
+
+	assert.Nil(t, manager.AddUserRoles("user@test.com", "admin", "viewer"))
+	users.Fail("UserRoles", errors.New("unavailable"))
+	assert.Nil(t, manager.RemoveUserRoles("user@test.com", "admin"))
+	users.Fail("UserRoles", nil)
+	assert.Nil(t, manager.RemoveUserRoles("user@test.com", "viewer"))
+
+	assert.Len(t, sink.records, 3)
+	assert.Equal(t, []string{"admin", "viewer"}, sink.records[0].RolesAfter)
+	assert.Nil(t, sink.records[1].RolesAfter, "unknown roles stay unknown")
+	assert.Equal(t, []string{"viewer"}, sink.records[2].RolesBefore)
+	assert.Equal(t, []string{}, sink.records[2].RolesAfter)
+}
+
+func TestActorFromContext(t *testing.T) {
+	ctx := core.NewContext(context.Background(), &core.Authorization{Token: "token", Key: "admin-key"})
+	assert.Equal(t, "", ActorFromContext(ctx), "the key of an authorization is not trusted")
+	assert.Equal(t, "admin@test.com", ActorFromContext(NewContext(ctx, "admin@test.com")))
+}
+
+func TestManagerRecordsReads(t *testing.T) {
+	manager, sink, _ := newManager(Options{Reads: true})
+
+	_, err := manager.UserRoles("user@test.com")
+	assert.Nil(t, err)
+	_, err = manager.ListUsers(1, 10, false)
+	assert.Nil(t, err)
+
+	assert.Len(t, sink.records, 2)
+	assert.Equal(t, UserRoles, sink.records[0].Operation)
+	assert.Equal(t, "", sink.records[0].Actor)
+	assert.Nil(t, sink.records[0].RolesAfter)
+	assert.Equal(t, ListUsers, sink.records[1].Operation)
+}
+
+func TestManagerReportsSinkErrors(t *testing.T) {
+	var reported error
+	manager, sink, _ := newManager(Options{OnError: func(err error) { reported = err }})
+	sink.err = errors.New("disk full")
+
+	assert.Nil(t, manager.AddUserRoles("user@test.com", "admin"))
+	assert.Equal(t, sink.err, reported)
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	manager, sink, _ := newManager(Options{})
+	for _, role := range []string{"a", "b", "c", "d"} {
+		assert.Nil(t, manager.AddUserRoles("user@test.com", role))
+	}
+	records := sink.records
+	assert.Nil(t, Verify(records))
+	assert.Equal(t, &ChainError{Sequence: 3, Reason: "does not start the chain"}, Verify(records[2:]))
+	assert.Nil(t, VerifyAfter(records[1], records[2:]))
+	assert.Equal(t, &ChainError{Sequence: 3, Reason: "follows record 1"}, VerifyAfter(records[0], records[2:]))
+
+	altered := append([]Record(nil), records...)
+	altered[1].Actor = "someone else"
+	assert.Equal(t, &ChainError{Sequence: 2, Reason: "hash mismatch"}, Verify(altered))
+
+	removed := append(append([]Record(nil), records[:1]...), records[2:]...)
+	assert.Equal(t, &ChainError{Sequence: 3, Reason: "follows record 1"}, Verify(removed))
+
+	rehashed := append([]Record(nil), records...)
+	rehashed[1].Actor = "someone else"
+	rehashed[1].Hash = rehashed[1].hash()
+	assert.Equal(t, &ChainError{Sequence: 3, Reason: "previous hash mismatch"}, Verify(rehashed))
+}
+
+func TestWriterSink(t *testing.T) {
+	var buffer bytes.Buffer
+	log := NewLog(NewWriterSink(&buffer), nil)
+	for _, operation := range []string{CreateUser, AddUserRoles} {
+		_, err := log.Append(Record{Operation: operation, Result: Success})
+		assert.Nil(t, err)
+	}
+
+	assert.Equal(t, 2, bytes.Count(buffer.Bytes(), []byte("\n")))
+	records, err := ReadRecords(&buffer)
+	assert.Nil(t, err)
+	assert.Len(t, records, 2)
+	assert.Nil(t, Verify(records))
+}
+
+func TestFileSinkContinuesChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "audit.ndjson")
+
+	for i := 0; i < 2; i++ {
+		sink, err := NewFileSink(filename)
+		assert.Nil(t, err)
+		log := NewLog(sink, sink.Last())
+		_, err = log.Append(Record{Operation: AddUserRoles, Result: Success, RolesBefore: []string{}})
+		assert.Nil(t, err)
+		_, err = log.Append(Record{Operation: RemoveUserRoles, Result: Success})
+		assert.Nil(t, err)
+		assert.Nil(t, sink.Close())
+	}
+
+	file, err := os.Open(filename)
+	assert.Nil(t, err)
+	defer file.Close()
+	records, err := ReadRecords(file)
+	assert.Nil(t, err)
+	assert.Len(t, records, 4)
+	assert.Equal(t, uint64(4), records[3].Sequence)
+	assert.Nil(t, Verify(records))
+}
+
+func TestFileSinkTornTail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "audit.ndjson")
+
+	var buffer bytes.Buffer
+	log := NewLog(NewWriterSink(&buffer), nil)
+	for i := 0; i < 2; i++ {
+		_, err = log.Append(Record{Operation: AddUserRoles, Result: Success, Error: strings.Repeat("x", tailChunk)})
+		assert.Nil(t, err)
+	}
+	complete := buffer.Len()
+	buffer.WriteString(`{"seq":3,"oper`)
+	assert.Nil(t, ioutil.WriteFile(filename, buffer.Bytes(), 0600))
+
+	sink, err := NewFileSink(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), sink.Last().Sequence)
+	_, err = NewLog(sink, sink.Last()).Append(Record{Operation: RemoveUserRoles, Result: Success})
+	assert.Nil(t, err)
+	assert.Nil(t, sink.Close())
+
+	data, err := ioutil.ReadFile(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, buffer.Bytes()[:complete], data[:complete], "the torn line is cut off")
+	records, err := ReadRecords(bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Len(t, records, 3)
+	assert.Nil(t, Verify(records))
+
+	assert.Nil(t, ioutil.WriteFile(filename, []byte(`{"seq":1`), 0600))
+	sink, err = NewFileSink(filename)
+	assert.Nil(t, err)
+	assert.Nil(t, sink.Last(), "a file with no complete line starts a new chain")
+	assert.Nil(t, sink.Close())
+	info, err := os.Stat(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), info.Size())
+}
+
+func TestChannelSink(t *testing.T) {
+	records := make(chan Record, 1)
+	log := NewLog(NewChannelSink(records), nil)
+
+	appended, err := log.Append(Record{Operation: CreateUser})
+	assert.Nil(t, err)
+	assert.Equal(t, *appended, <-records)
+
+	log.Append(Record{Operation: CreateUser})
+	_, err = log.Append(Record{Operation: CreateUser})
+	assert.Equal(t, ErrChannelFull, err)
+}
+
+func TestMultiSink(t *testing.T) {
+	failing := &memorySink{err: errors.New("failed")}
+	working := &memorySink{}
+	log := NewLog(MultiSink(failing, working), nil)
+
+	_, err := log.Append(Record{Operation: CreateUser})
+	assert.Equal(t, failing.err, err)
+	_, err = log.Append(Record{Operation: CreateUser})
+	assert.Equal(t, failing.err, err)
+	assert.Len(t, working.records, 2)
+	assert.Nil(t, Verify(working.records))
+}
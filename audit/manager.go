@@ -0,0 +1,189 @@
+package audit
+
+import (
+	"context"
+	"sort"
+
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stone-payments/globalidentity-go/management"
+)
+
+// Operations recorded by a Manager, named after the methods of
+// management.Manager.
+const (
+	CreateUser      = "CreateUser"
+	UpdateUser      = "UpdateUser"
+	AddUserRoles    = "AddUserRoles"
+	RemoveUserRoles = "RemoveUserRoles"
+	UserRoles       = "UserRoles"
+	RoleMap         = "RoleMap"
+	ListUsers       = "ListUsers"
+	User            = "User"
+)
+
+// Options configures a Manager.
+type Options struct {
+	// Reads also records the calls that change nothing, without roles.
+	Reads bool
+	// OnError receives the errors of the sink, which do not fail the
+	// audited call since it already happened. It may be nil.
+	OnError func(error)
+}
+
+// Manager is a management.Manager recording its calls in a log. The actor of
+// the calls is taken from the context set by WithContext.
+type Manager struct {
+	next    management.Manager
+	log     *Log
+	options Options
+	ctx     context.Context
+}
+
+// New returns a manager calling next and recording the calls in log.
+func New(next management.Manager, log *Log, options Options) *Manager {
+	return &Manager{next: next, log: log, options: options, ctx: context.Background()}
+}
+
+// WithContext returns a copy of the manager recording the actor of ctx.
+func (m *Manager) WithContext(ctx context.Context) *Manager {
+	copied := *m
+	copied.ctx = ctx
+	return &copied
+}
+
+func (m *Manager) UserRoles(email string) ([]core.Role, error) {
+	roles, err := m.next.UserRoles(email)
+	m.read(UserRoles, email, err)
+	return roles, err
+}
+
+func (m *Manager) RoleMap(email string, roles ...string) (map[string]bool, error) {
+	roleMap, err := m.next.RoleMap(email, roles...)
+	m.read(RoleMap, email, err)
+	return roleMap, err
+}
+
+func (m *Manager) ListUsers(pageNumber, pageSize int, includeRoles bool) (*core.ListUsersResponse, error) {
+	response, err := m.next.ListUsers(pageNumber, pageSize, includeRoles)
+	m.read(ListUsers, "", err)
+	return response, err
+}
+
+func (m *Manager) User(email string, includeRoles bool) (*core.User, error) {
+	user, err := m.next.User(email, includeRoles)
+	m.read(User, email, err)
+	return user, err
+}
+
+// CreateUser records no roles before the call, since the user did not
+// exist, and the roles of user after it. The password is never recorded.
+func (m *Manager) CreateUser(user core.User, password string) (*core.User, error) {
+	created, err := m.next.CreateUser(user, password)
+	m.write(CreateUser, user.Email, []string{}, changeRoles([]string{}, user.Roles, nil), err)
+	return created, err
+}
+
+// UpdateUser records the same roles before and after the call, which does
+// not change them.
+func (m *Manager) UpdateUser(user core.User) (*core.User, error) {
+	before := m.roles(user.Email)
+	updated, err := m.next.UpdateUser(user)
+	m.write(UpdateUser, user.Email, before, before, err)
+	return updated, err
+}
+
+func (m *Manager) AddUserRoles(email string, roles ...string) error {
+	before := m.roles(email)
+	err := m.next.AddUserRoles(email, roles...)
+	m.write(AddUserRoles, email, before, changeRoles(before, roles, nil), err)
+	return err
+}
+
+func (m *Manager) RemoveUserRoles(email string, roles ...string) error {
+	before := m.roles(email)
+	err := m.next.RemoveUserRoles(email, roles...)
+	m.write(RemoveUserRoles, email, before, changeRoles(before, nil, roles), err)
+	return err
+}
+
+func (m *Manager) Check(ctx context.Context) *core.HealthReport {
+	return m.next.Check(ctx)
+}
+
+func (m *Manager) Ping(ctx context.Context) error {
+	return m.next.Ping(ctx)
+}
+
+func (m *Manager) read(operation, target string, err error) {
+	if m.options.Reads {
+		m.append(operation, target, nil, nil, err)
+	}
+}
+
+// write records a write turning the roles of target from before into after
+// when it succeeds. A failed write is recorded as changing nothing.
+func (m *Manager) write(operation, target string, before, after []string, err error) {
+	if err != nil {
+		after = before
+	}
+	m.append(operation, target, before, after, err)
+}
+
+func (m *Manager) append(operation, target string, before, after []string, err error) {
+	record := Record{
+		Actor:       ActorFromContext(m.ctx),
+		Operation:   operation,
+		Target:      target,
+		RolesBefore: before,
+		RolesAfter:  after,
+		Result:      Success,
+	}
+	if err != nil {
+		record.Result = Failure
+		record.Error = err.Error()
+	}
+	if _, err = m.log.Append(record); err != nil && m.options.OnError != nil {
+		m.options.OnError(err)
+	}
+}
+
+// roles returns the sorted names of the active roles of the user, or nil
+// when they cannot be read.
+func (m *Manager) roles(email string) []string {
+	roles, err := m.next.UserRoles(email)
+	if err != nil {
+		return nil
+	}
+	names := []string{}
+	for _, role := range roles {
+		if role.Active {
+			names = append(names, role.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// changeRoles returns the sorted roles of before with added and without
+// removed, or nil when before is unknown.
+func changeRoles(before, added, removed []string) []string {
+	if before == nil {
+		return nil
+	}
+	kept := make(map[string]bool, len(before)+len(added))
+	for _, role := range before {
+		kept[role] = true
+	}
+	for _, role := range added {
+		kept[role] = true
+	}
+	for _, role := range removed {
+		delete(kept, role)
+	}
+	after := make([]string, 0, len(kept))
+	for role := range kept {
+		after = append(after, role)
+	}
+	sort.Strings(after)
+	return after
+}
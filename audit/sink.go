@@ -0,0 +1,170 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// tailChunk is how much of a file is read at a time looking for its last
+// record.
+const tailChunk = 4096
+
+// ErrChannelFull is returned by a channel sink whose channel has no room.
+var ErrChannelFull = errors.New("audit: channel full")
+
+// Sink stores records.
+type Sink interface {
+	Write(record *Record) error
+}
+
+type writerSink struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+// NewWriterSink returns a sink writing records to w as NDJSON, one record
+// per line.
+func NewWriterSink(w io.Writer) Sink {
+	return &writerSink{writer: w}
+}
+
+func (s *writerSink) Write(record *Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err = s.writer.Write(append(data, '\n'))
+	return err
+}
+
+// FileSink appends records to an NDJSON file.
+type FileSink struct {
+	Sink
+	file *os.File
+	last *Record
+}
+
+// NewFileSink opens filename for appending, creating it when needed, and
+// reads its last record so the chain can continue from it. Only the end of
+// the file is read. A torn last line, left by a crash in the middle of a
+// write, is cut off.
+func NewFileSink(filename string) (*FileSink, error) {
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	last, err := readLast(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &FileSink{Sink: NewWriterSink(file), file: file, last: last}, nil
+}
+
+// readLast returns the record on the last complete line of file, or nil when
+// it has none, truncating whatever follows that line.
+func readLast(file *os.File) (*Record, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// tail holds the file from offset on; end is the offset past the last
+	// newline, or -1 until found.
+	var tail []byte
+	offset, end := info.Size(), int64(-1)
+	var line []byte
+	for offset > 0 && line == nil {
+		size := int64(tailChunk)
+		if size > offset {
+			size = offset
+		}
+		offset -= size
+		chunk := make([]byte, size)
+		if _, err = file.ReadAt(chunk, offset); err != nil {
+			return nil, err
+		}
+		tail = append(chunk, tail...)
+
+		if end < 0 {
+			i := bytes.LastIndexByte(tail, '\n')
+			if i < 0 {
+				continue
+			}
+			end = offset + int64(i) + 1
+		}
+		if i := bytes.LastIndexByte(tail[:end-offset-1], '\n'); i >= 0 {
+			line = tail[i+1 : end-offset-1]
+		} else if offset == 0 {
+			line = tail[:end-1]
+		}
+	}
+
+	if end < 0 {
+		end = 0
+	}
+	if end < info.Size() {
+		if err = file.Truncate(end); err != nil {
+			return nil, err
+		}
+	}
+	if line == nil {
+		return nil, nil
+	}
+	last := new(Record)
+	if err = json.Unmarshal(line, last); err != nil {
+		return nil, err
+	}
+	return last, nil
+}
+
+// Last returns the last record of the file when it was opened, or nil.
+func (s *FileSink) Last() *Record {
+	return s.last
+}
+
+// Close closes the file.
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+type channelSink chan<- Record
+
+// NewChannelSink returns a sink sending records on records. It never blocks
+// the audited call: ErrChannelFull is returned when the channel has no room.
+func NewChannelSink(records chan<- Record) Sink {
+	return channelSink(records)
+}
+
+func (s channelSink) Write(record *Record) error {
+	select {
+	case s <- *record:
+		return nil
+	default:
+		return ErrChannelFull
+	}
+}
+
+type multiSink []Sink
+
+// MultiSink returns a sink writing to every one of sinks. The first error is
+// returned once all of them have been written to.
+func MultiSink(sinks ...Sink) Sink {
+	return multiSink(sinks)
+}
+
+func (s multiSink) Write(record *Record) error {
+	var first error
+	for _, sink := range s {
+		if err := sink.Write(record); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
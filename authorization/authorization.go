@@ -8,4 +8,9 @@ const (
 	validateTokenSuffix       = "/api/authorization/validateToken"
 	renewTokenSuffix          = "/api/authorization/renewtoken"
 	recoverPasswordSuffix     = "/api/authorization/recoverPassword"
+	resetPasswordSuffix       = "/api/authorization/resetPassword"
+	changePasswordSuffix      = "/api/authorization/changePassword"
+	validateRecoverySuffix    = "/api/authorization/validateRecoveryToken"
+	revokeTokenSuffix         = "/api/authorization/revokeToken"
+	revokeUserTokensSuffix    = "/api/authorization/revokeUserTokens"
 )
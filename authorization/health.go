@@ -0,0 +1,64 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	core "github.com/stone-payments/globalidentity-go"
+)
+
+// healthCheckToken is validated by Check. It is never a valid token, so a
+// healthy server answers with a failed validation.
+const healthCheckToken = "globalidentity-go-health-check"
+
+// Check validates a token that does not exist, verifying that Global
+// Identity is reachable and that it does not reject the application key.
+func (gim *globalIdentityManager) Check(ctx context.Context) *core.HealthReport {
+	report := core.NewHealthReport("authorization")
+
+	requestOptions := gim.requestOptions()
+	requestOptions.Context = ctx
+	requestOptions.JSON = &validateTokenRequest{
+		ApplicationKey: gim.applicationKey,
+		Token:          healthCheckToken,
+	}
+
+	start := time.Now()
+	resp, err := gim.requester.Post(gim.globalIdentityHost+validateTokenSuffix, requestOptions)
+	report.Latency = time.Since(start)
+
+	if err != nil {
+		giErr, ok := err.(core.GlobalIdentityError)
+		if !ok || giErr.StatusCode() >= 500 || giErr.StatusCode() == 0 {
+			report.Add(core.CheckReachable, err)
+			return report
+		}
+		report.Add(core.CheckReachable, nil)
+		report.Add(core.CheckApplicationKey, fmt.Errorf("unexpected status %d", giErr.StatusCode()))
+		return report
+	}
+
+	var response core.Response
+	if err = resp.JSON(&response); err != nil {
+		report.Add(core.CheckReachable, fmt.Errorf("invalid response: %v", err))
+		return report
+	}
+	report.Add(core.CheckReachable, nil)
+
+	for _, operation := range response.OperationReport {
+		if strings.EqualFold(operation.Field, "ApplicationKey") {
+			report.Add(core.CheckApplicationKey, errors.New(operation.Message))
+			return report
+		}
+	}
+	report.Add(core.CheckApplicationKey, nil)
+	return report
+}
+
+// Ping returns the error of Check, or nil if the manager is healthy.
+func (gim *globalIdentityManager) Ping(ctx context.Context) error {
+	return gim.Check(ctx).Err()
+}
@@ -0,0 +1,45 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/jarcoal/httpmock"
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	defer leaktest.Check(t)()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	gim := New("test", globalApplicationUrl)
+
+	httpmock.RegisterResponder("POST", validateTokenUrl, httpmock.NewStringResponder(http.StatusOK, `{"Success": false, "OperationReport": [{"Field": "Token", "Message": "Invalid token"}]}`))
+	report := gim.Check(context.Background())
+	assert.True(t, report.Healthy)
+	assert.Equal(t, "authorization", report.Component)
+	assert.Equal(t, []core.HealthCheck{{Name: core.CheckReachable, OK: true}, {Name: core.CheckApplicationKey, OK: true}}, report.Checks)
+	assert.Nil(t, gim.Ping(context.Background()))
+
+	httpmock.RegisterResponder("POST", validateTokenUrl, httpmock.NewStringResponder(http.StatusOK, `{"Success": false, "OperationReport": [{"Field": "ApplicationKey", "Message": "Application not found"}]}`))
+	report = gim.Check(context.Background())
+	assert.False(t, report.Healthy)
+	assert.Equal(t, core.HealthCheck{Name: core.CheckApplicationKey, Error: "Application not found"}, report.Checks[1])
+
+	httpmock.RegisterResponder("POST", validateTokenUrl, httpmock.NewStringResponder(http.StatusNotFound, ""))
+	report = gim.Check(context.Background())
+	assert.False(t, report.Healthy)
+	assert.True(t, report.Checks[0].OK)
+	assert.False(t, report.Checks[1].OK)
+
+	httpmock.RegisterResponder("POST", validateTokenUrl, httpmock.NewErrorResponder(errors.New("connection refused")))
+	report = gim.Check(context.Background())
+	assert.False(t, report.Healthy)
+	assert.Len(t, report.Checks, 1)
+	assert.NotNil(t, gim.Ping(context.Background()))
+}
@@ -1,9 +1,16 @@
 package authorization
 
 import (
+	"context"
+	"strings"
+	"time"
+
 	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stone-payments/globalidentity-go/internal/singleflight"
 )
 
+const defaultRoleCheckWorkers = 4
+
 type GlobalIdentityManager interface {
 	AuthenticateUser(email string, password string, expirationInMinutes ...int) (*core.Authorization, error)
 	ValidateToken(token string) (bool, error)
@@ -13,18 +20,142 @@ type GlobalIdentityManager interface {
 	RecoverPassword(email string) (bool, error)
 }
 
+// RoleChecker checks several roles of a user at once.
+type RoleChecker interface {
+	HasAnyRole(userKey string, roles ...string) (bool, error)
+	HasAllRoles(userKey string, roles ...string) (bool, error)
+	RoleMap(userKey string, roles ...string) (map[string]bool, error)
+}
+
+// PasswordManager completes password recoveries and changes passwords.
+type PasswordManager interface {
+	ResetPassword(recoveryToken string, newPassword string) (bool, error)
+	ChangePassword(email string, oldPassword string, newPassword string) (bool, error)
+	ValidateRecoveryToken(recoveryToken string) (bool, error)
+}
+
+// TokenRevoker invalidates tokens before they expire.
+type TokenRevoker interface {
+	RevokeToken(token string) (bool, error)
+	RevokeUserTokens(userKey string) (bool, error)
+}
+
+// Manager is implemented by the managers returned by New. The interfaces it
+// adds to GlobalIdentityManager are kept apart so existing implementations of
+// GlobalIdentityManager keep compiling; code accepting a
+// GlobalIdentityManager detects them with a type assertion.
+type Manager interface {
+	GlobalIdentityManager
+	RoleChecker
+	PasswordManager
+	TokenRevoker
+	Check(ctx context.Context) *core.HealthReport
+	Ping(ctx context.Context) error
+}
+
 type globalIdentityManager struct {
 	applicationKey     string
 	globalIdentityHost string
 	requester          core.Requester
+	endpoints          []core.Endpoint
+	failoverOptions    core.FailoverOptions
+	rateLimits         map[core.OperationClass]core.Limit
+	flight             *singleflight.Group
+	stale              *staleCache
+	listeners          []RevocationListener
+	roleCheckWorkers   int
+}
+
+// Option configures a manager created with New.
+type Option func(*globalIdentityManager)
+
+// WithRequester makes the manager send its requests through requester.
+func WithRequester(requester core.Requester) Option {
+	return func(gim *globalIdentityManager) {
+		gim.requester = requester
+	}
+}
+
+// WithHosts makes the manager fail over between hosts, tried in order. The
+// host given to New is then ignored.
+func WithHosts(hosts ...string) Option {
+	return WithEndpoints(core.Hosts(hosts...), core.FailoverOptions{})
+}
+
+// WithEndpoints makes the manager fail over between weighted endpoints. The
+// host given to New is then ignored.
+func WithEndpoints(endpoints []core.Endpoint, options core.FailoverOptions) Option {
+	return func(gim *globalIdentityManager) {
+		gim.endpoints = endpoints
+		gim.failoverOptions = options
+	}
+}
+
+// WithoutCoalescing makes every ValidateToken and role check send its own
+// request. By default concurrent identical calls share a single request.
+func WithoutCoalescing() Option {
+	return func(gim *globalIdentityManager) {
+		gim.flight = nil
+	}
+}
+
+// WithStaleOnError makes ValidateToken and IsUserInRoles serve the last
+// successful result for the same token or user and roles when Global
+// Identity is unreachable or answers with a 5xx status, as long as that
+// result is not older than grace. Tokens and users never seen before are not
+// affected. The observer, which may be nil, is called whenever a stale result
+// is served.
+func WithStaleOnError(grace time.Duration, observer StaleObserver) Option {
+	return func(gim *globalIdentityManager) {
+		gim.stale = newStaleCache(grace, observer)
+	}
+}
+
+// WithRevocationListener notifies listener of every successful revocation,
+// so state derived from the revoked tokens, such as sessions, can be
+// dropped.
+func WithRevocationListener(listener RevocationListener) Option {
+	return func(gim *globalIdentityManager) {
+		gim.listeners = append(gim.listeners, listener)
+	}
+}
+
+// WithRateLimits limits the requests sent by the manager per operation
+// class. To share limits between managers, give them the same
+// core.RateLimitedRequester with WithRequester instead.
+func WithRateLimits(limits map[core.OperationClass]core.Limit) Option {
+	return func(gim *globalIdentityManager) {
+		gim.rateLimits = limits
+	}
+}
+
+// WithRoleCheckWorkers bounds the number of concurrent requests sent by
+// RoleMap, HasAnyRole and HasAllRoles. It defaults to 4.
+func WithRoleCheckWorkers(workers int) Option {
+	return func(gim *globalIdentityManager) {
+		gim.roleCheckWorkers = workers
+	}
 }
 
-func New(applicationKey string, globalIdentityHost string) GlobalIdentityManager {
-	return &globalIdentityManager{
-		applicationKey,
-		globalIdentityHost,
-		core.NewRequester(),
+func New(applicationKey string, globalIdentityHost string, options ...Option) Manager {
+	gim := &globalIdentityManager{
+		applicationKey:     applicationKey,
+		globalIdentityHost: globalIdentityHost,
+		requester:          core.NewRequester(),
+		flight:             new(singleflight.Group),
+		roleCheckWorkers:   defaultRoleCheckWorkers,
+	}
+	for _, option := range options {
+		option(gim)
+	}
+	if len(gim.endpoints) > 0 {
+		gim.requester = core.NewFailoverRequester(gim.endpoints, gim.requester, gim.failoverOptions)
+		gim.globalIdentityHost = ""
 	}
+	if len(gim.rateLimits) > 0 {
+		gim.requester = core.NewRateLimitedRequester(gim.requester, gim.rateLimits)
+	}
+	return gim
 }
 
 func (gim *globalIdentityManager) AuthenticateUser(email string, password string, expirationInMinutes ...int) (*core.Authorization, error) {
@@ -55,8 +186,12 @@ func (gim *globalIdentityManager) AuthenticateUser(email string, password string
 	var globalIdentityUser *core.Authorization
 	if response.Success {
 		globalIdentityUser = &core.Authorization{
-			Token: response.AuthenticationToken,
-			Key:   response.UserKey,
+			Token:                    response.AuthenticationToken,
+			Key:                      response.UserKey,
+			TokenExpirationInMinutes: response.TokenExpirationInMinutes,
+		}
+		if globalIdentityUser.TokenExpirationInMinutes == 0 {
+			globalIdentityUser.TokenExpirationInMinutes = expirationInMinutes[0]
 		}
 	} else {
 		var messages []string
@@ -96,7 +231,70 @@ func (gim *globalIdentityManager) RecoverPassword(email string) (bool, error) {
 	return response.Success, err
 }
 
+// ResetPassword completes the flow started by RecoverPassword, setting the
+// password of the user the recovery token was sent to.
+func (gim *globalIdentityManager) ResetPassword(recoveryToken string, newPassword string) (bool, error) {
+	return gim.post(resetPasswordSuffix, &resetPasswordRequest{
+		ApplicationKey: gim.applicationKey,
+		RecoveryToken:  recoveryToken,
+		NewPassword:    newPassword,
+	})
+}
+
+// ChangePassword replaces the password of a user who knows the current one.
+func (gim *globalIdentityManager) ChangePassword(email string, oldPassword string, newPassword string) (bool, error) {
+	return gim.post(changePasswordSuffix, &changePasswordRequest{
+		ApplicationKey: gim.applicationKey,
+		Email:          email,
+		OldPassword:    oldPassword,
+		NewPassword:    newPassword,
+	})
+}
+
+// ValidateRecoveryToken reports whether the recovery token can still be used
+// with ResetPassword, so an expired link can be reported before the user
+// fills the reset form.
+func (gim *globalIdentityManager) ValidateRecoveryToken(recoveryToken string) (bool, error) {
+	return gim.post(validateRecoverySuffix, &validateRecoveryTokenRequest{
+		ApplicationKey: gim.applicationKey,
+		RecoveryToken:  recoveryToken,
+	})
+}
+
+// post sends request to the endpoint and validates the response envelope.
+func (gim *globalIdentityManager) post(suffix string, request interface{}) (bool, error) {
+	requestOptions := gim.requestOptions()
+	requestOptions.JSON = request
+
+	resp, err := gim.requester.Post(gim.globalIdentityHost+suffix, requestOptions)
+	if err != nil {
+		return false, err
+	}
+
+	var response core.Response
+	if err = resp.JSON(&response); err != nil {
+		return false, err
+	}
+
+	if err = response.Validate(); err != nil {
+		return false, err
+	}
+
+	return response.Success, err
+}
+
 func (gim *globalIdentityManager) ValidateToken(token string) (bool, error) {
+	value, err := gim.stale.do(ValidateTokenOperation, token, func() (interface{}, error) {
+		value, err, _ := gim.flight.Do("validateToken\x00"+token, func() (interface{}, error) {
+			return gim.validateToken(token)
+		})
+		return value, err
+	})
+	valid, _ := value.(bool)
+	return valid, err
+}
+
+func (gim *globalIdentityManager) validateToken(token string) (bool, error) {
 	request := &validateTokenRequest{
 		ApplicationKey: gim.applicationKey,
 		Token:          token,
@@ -123,6 +321,117 @@ func (gim *globalIdentityManager) ValidateToken(token string) (bool, error) {
 }
 
 func (gim *globalIdentityManager) IsUserInRoles(userKey string, roles ...string) (bool, error) {
+	response, err := gim.isUserInRoles(userKey, roles)
+	if err != nil {
+		return false, err
+	}
+
+	if err = response.Validate(); err != nil {
+		return false, err
+	}
+
+	return response.Success, err
+}
+
+// HasAnyRole reports whether the user holds at least one of the roles.
+func (gim *globalIdentityManager) HasAnyRole(userKey string, roles ...string) (bool, error) {
+	held, err := gim.RoleMap(userKey, roles...)
+	if err != nil {
+		return false, err
+	}
+
+	for _, ok := range held {
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// HasAllRoles reports whether the user holds every one of the roles.
+func (gim *globalIdentityManager) HasAllRoles(userKey string, roles ...string) (bool, error) {
+	held, err := gim.RoleMap(userKey, roles...)
+	if err != nil {
+		return false, err
+	}
+
+	for _, ok := range held {
+		if !ok {
+			return false, nil
+		}
+	}
+	return len(held) > 0, nil
+}
+
+// RoleMap checks each role, a few at a time as set by WithRoleCheckWorkers,
+// and reports which of them the user holds. An error is returned only when a
+// check could not be completed.
+func (gim *globalIdentityManager) RoleMap(userKey string, roles ...string) (map[string]bool, error) {
+	type result struct {
+		role string
+		held bool
+		err  error
+	}
+
+	pending := make(chan string, len(roles))
+	for _, role := range roles {
+		pending <- role
+	}
+	close(pending)
+
+	workers := gim.roleCheckWorkers
+	if workers < 1 {
+		workers = defaultRoleCheckWorkers
+	}
+	if workers > len(roles) {
+		workers = len(roles)
+	}
+
+	results := make(chan result, len(roles))
+	for i := 0; i < workers; i++ {
+		go func() {
+			for role := range pending {
+				response, err := gim.isUserInRoles(userKey, []string{role})
+				if err != nil {
+					results <- result{role: role, err: err}
+					continue
+				}
+				results <- result{role: role, held: response.Success}
+			}
+		}()
+	}
+
+	held := make(map[string]bool, len(roles))
+	var err error
+	for range roles {
+		r := <-results
+		if r.err != nil && err == nil {
+			err = r.err
+		}
+		held[r.role] = r.held
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return held, nil
+}
+
+func (gim *globalIdentityManager) isUserInRoles(userKey string, roles []string) (*core.Response, error) {
+	key := userKey + "\x00" + strings.Join(roles, "\x00")
+	value, err := gim.stale.do(IsUserInRolesOperation, key, func() (interface{}, error) {
+		value, err, _ := gim.flight.Do("isUserInRoles\x00"+key, func() (interface{}, error) {
+			return gim.requestIsUserInRoles(userKey, roles)
+		})
+		return value, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*core.Response), nil
+}
+
+func (gim *globalIdentityManager) requestIsUserInRoles(userKey string, roles []string) (*core.Response, error) {
 	request := &isUserInHolesRequest{
 		ApplicationKey: gim.applicationKey,
 		UserKey:        userKey,
@@ -134,19 +443,15 @@ func (gim *globalIdentityManager) IsUserInRoles(userKey string, roles ...string)
 
 	resp, err := gim.requester.Post(gim.globalIdentityHost+isUserInRolesSuffix, requestOptions)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	var response core.Response
 	if err = resp.JSON(&response); err != nil {
-		return false, err
-	}
-
-	if err = response.Validate(); err != nil {
-		return false, err
+		return nil, err
 	}
 
-	return response.Success, err
+	return &response, nil
 }
 
 func (gim *globalIdentityManager) RenewToken(token string) (string, error) {
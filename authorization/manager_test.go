@@ -3,7 +3,9 @@ package authorization
 import (
 	"encoding/json"
 	"net/http"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/fortytw2/leaktest"
 	"github.com/jarcoal/httpmock"
@@ -154,10 +156,11 @@ func TestAuthenticateUser(t *testing.T) {
 	httpmock.RegisterResponder("POST", authenticateUserUrl, httpmock.NewStringResponder(http.StatusOK, string(okResponse)))
 
 	gim = New("test", globalApplicationUrl)
-	_, err = gim.AuthenticateUser("", "", 1)
+	authorization, err := gim.AuthenticateUser("", "", 1)
 	if err != nil {
 		t.FailNow()
 	}
+	assert.Equal(t, &core.Authorization{Token: "banana", Key: "user", TokenExpirationInMinutes: 1}, authorization)
 
 	oprep := []loginOperationReport{
 		{Message: "error1", Field: "login"},
@@ -375,3 +378,187 @@ func TestRenewToken(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestRoleMap(t *testing.T) {
+	defer leaktest.Check(t)()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", isUserInRolesUrl, func(req *http.Request) (*http.Response, error) {
+		var request isUserInHolesRequest
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			return nil, err
+		}
+		if len(request.RoleCollection) == 1 && request.RoleCollection[0] == "ADMIN" {
+			return httpmock.NewStringResponse(http.StatusOK, `{"Success": true, "OperationReport": []}`), nil
+		}
+		return httpmock.NewStringResponse(http.StatusOK, `{"Success": false, "OperationReport": [{"Message": "not in role"}]}`), nil
+	})
+
+	gim := New("test", globalApplicationUrl)
+
+	roles, err := gim.RoleMap("user", "ADMIN", "FINANCE")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]bool{"ADMIN": true, "FINANCE": false}, roles)
+
+	ok, err := gim.HasAnyRole("user", "ADMIN", "FINANCE")
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	ok, err = gim.HasAllRoles("user", "ADMIN", "FINANCE")
+	assert.False(t, ok)
+	assert.Nil(t, err)
+
+	ok, err = gim.HasAllRoles("user", "ADMIN")
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	httpmock.RegisterResponder("POST", isUserInRolesUrl, httpmock.NewStringResponder(http.StatusInternalServerError, ""))
+
+	_, err = gim.RoleMap("user", "ADMIN", "FINANCE")
+	assert.NotNil(t, err)
+}
+
+func TestRoleMapWorkers(t *testing.T) {
+	defer leaktest.Check(t)()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var mutex sync.Mutex
+	var running, peak int
+	httpmock.RegisterResponder("POST", isUserInRolesUrl, func(req *http.Request) (*http.Response, error) {
+		mutex.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mutex.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+		return httpmock.NewStringResponse(http.StatusOK, `{"Success": true, "OperationReport": []}`), nil
+	})
+
+	gim := New("test", globalApplicationUrl, WithRoleCheckWorkers(2))
+	roles, err := gim.RoleMap("user", "A", "B", "C", "D", "E", "F")
+	assert.Nil(t, err)
+	assert.Len(t, roles, 6)
+	assert.Equal(t, 6, httpmock.GetTotalCallCount())
+	assert.Equal(t, 2, peak)
+}
+
+func TestWithHosts(t *testing.T) {
+	defer leaktest.Check(t)()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", "https://secondary.dlp-payments.com/api/authorization/validateToken", httpmock.NewStringResponder(http.StatusOK, `{"Success": true, "OperationReport": []}`))
+	httpmock.RegisterResponder("POST", validateTokenUrl, httpmock.NewStringResponder(http.StatusBadGateway, ""))
+
+	gim := New("test", "", WithHosts(globalApplicationUrl, "https://secondary.dlp-payments.com"))
+	ok, err := gim.ValidateToken("token")
+	assert.True(t, ok)
+	assert.Nil(t, err)
+}
+
+func TestWithRateLimits(t *testing.T) {
+	defer leaktest.Check(t)()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", validateTokenUrl, httpmock.NewStringResponder(http.StatusOK, `{"Success": true, "OperationReport": []}`))
+
+	gim := New("test", globalApplicationUrl, WithRateLimits(map[core.OperationClass]core.Limit{core.Validation: {Rate: 0.001, Burst: 1}}))
+	ok, err := gim.ValidateToken("token")
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	_, err = gim.ValidateToken("token")
+	assert.Equal(t, core.RateLimitedError{Class: core.Validation}, err)
+}
+
+func TestValidateTokenCoalescing(t *testing.T) {
+	defer leaktest.Check(t)()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	release := make(chan struct{})
+	httpmock.RegisterResponder("POST", validateTokenUrl, func(req *http.Request) (*http.Response, error) {
+		<-release
+		return httpmock.NewStringResponse(http.StatusOK, `{"Success": true, "OperationReport": []}`), nil
+	})
+
+	validate := func(gim GlobalIdentityManager, calls int, unblock func()) {
+		var wg sync.WaitGroup
+		for i := 0; i < calls; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ok, err := gim.ValidateToken("token")
+				assert.True(t, ok)
+				assert.Nil(t, err)
+			}()
+		}
+		time.Sleep(100 * time.Millisecond)
+		unblock()
+		wg.Wait()
+	}
+
+	validate(New("test", globalApplicationUrl), 5, func() { release <- struct{}{} })
+	assert.Equal(t, 1, httpmock.GetTotalCallCount())
+
+	httpmock.ZeroCallCounters()
+	validate(New("test", globalApplicationUrl, WithoutCoalescing()), 5, func() { close(release) })
+	assert.Equal(t, 5, httpmock.GetTotalCallCount())
+}
+
+func TestPasswordFlow(t *testing.T) {
+	defer leaktest.Check(t)()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	resetPasswordUrl := globalApplicationUrl + "/api/authorization/resetPassword"
+	changePasswordUrl := globalApplicationUrl + "/api/authorization/changePassword"
+	validateRecoveryTokenUrl := globalApplicationUrl + "/api/authorization/validateRecoveryToken"
+
+	var body map[string]string
+	ok := func(req *http.Request) (*http.Response, error) {
+		body = nil
+		json.NewDecoder(req.Body).Decode(&body)
+		return httpmock.NewStringResponse(http.StatusOK, `{"Success": true, "OperationReport": []}`), nil
+	}
+	httpmock.RegisterResponder("POST", resetPasswordUrl, ok)
+	httpmock.RegisterResponder("POST", changePasswordUrl, ok)
+	httpmock.RegisterResponder("POST", validateRecoveryTokenUrl, ok)
+
+	gim := New("test", globalApplicationUrl)
+
+	valid, err := gim.ValidateRecoveryToken("recovery")
+	assert.True(t, valid)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"ApplicationKey": "test", "RecoveryToken": "recovery"}, body)
+
+	reset, err := gim.ResetPassword("recovery", "new")
+	assert.True(t, reset)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"ApplicationKey": "test", "RecoveryToken": "recovery", "NewPassword": "new"}, body)
+
+	changed, err := gim.ChangePassword("test@test.com.br", "old", "new")
+	assert.True(t, changed)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"ApplicationKey": "test", "Email": "test@test.com.br", "OldPassword": "old", "NewPassword": "new"}, body)
+
+	httpmock.RegisterResponder("POST", validateRecoveryTokenUrl, httpmock.NewStringResponder(http.StatusOK, `{"Success": false, "OperationReport": [{"Message": "expired"}]}`))
+	valid, err = gim.ValidateRecoveryToken("recovery")
+	assert.False(t, valid)
+	assert.Equal(t, core.GlobalIdentityError{"expired"}, err)
+
+	httpmock.RegisterResponder("POST", changePasswordUrl, httpmock.NewStringResponder(http.StatusInternalServerError, ""))
+	_, err = gim.ChangePassword("test@test.com.br", "old", "new")
+	assert.NotNil(t, err)
+
+	httpmock.RegisterResponder("POST", resetPasswordUrl, httpmock.NewStringResponder(http.StatusOK, "mock"))
+	_, err = gim.ResetPassword("recovery", "new")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,160 @@
+package authorization
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultReplayWindow = 5 * time.Minute
+
+// ReplayError is returned by a replay protected manager when rawData is
+// outside the accepted time window or carries a nonce that was already used.
+type ReplayError string
+
+func (e ReplayError) Error() string {
+	return "replay protection: " + string(e)
+}
+
+// RawDataParser extracts the timestamp and the nonce embedded in rawData.
+type RawDataParser func(rawData string) (time.Time, string, error)
+
+// ParseRawData is the default RawDataParser. It expects rawData in the
+// "<unix timestamp>:<nonce>:<payload>" format, the payload being optional.
+func ParseRawData(rawData string) (time.Time, string, error) {
+	parts := strings.SplitN(rawData, ":", 3)
+	if len(parts) < 2 || parts[1] == "" {
+		return time.Time{}, "", ReplayError("malformed raw data")
+	}
+
+	seconds, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, "", ReplayError("malformed timestamp")
+	}
+
+	return time.Unix(seconds, 0), parts[1], nil
+}
+
+// NonceStore keeps track of the nonces already used by clients.
+type NonceStore interface {
+	// Use records the nonce until expiresAt. It returns false when the nonce
+	// was already recorded and has not expired yet.
+	Use(nonce string, expiresAt time.Time) (bool, error)
+}
+
+// memoryNonceSweepInterval is how often the memory store drops expired
+// nonces. Expired nonces are accepted again as soon as they expire; the sweep
+// only bounds memory.
+const memoryNonceSweepInterval = time.Minute
+
+type memoryNonceStore struct {
+	mutex     sync.Mutex
+	nonces    map[string]time.Time
+	nextSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryNonceStore returns a NonceStore that keeps nonces in memory.
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonceStore{
+		nonces: make(map[string]time.Time),
+		now:    time.Now,
+	}
+}
+
+func (s *memoryNonceStore) Use(nonce string, expiresAt time.Time) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	if !now.Before(s.nextSweep) {
+		for n, expiration := range s.nonces {
+			if !expiration.After(now) {
+				delete(s.nonces, n)
+			}
+		}
+		s.nextSweep = now.Add(memoryNonceSweepInterval)
+	}
+
+	if expiration, found := s.nonces[nonce]; found && expiration.After(now) {
+		return false, nil
+	}
+	s.nonces[nonce] = expiresAt
+
+	return true, nil
+}
+
+type replayGuard struct {
+	GlobalIdentityManager
+	store  NonceStore
+	window time.Duration
+	parse  RawDataParser
+	now    func() time.Time
+}
+
+// WithReplayProtection wraps the manager so ValidateApplication only accepts
+// rawData whose timestamp is within window of the current time and whose
+// nonce was never used before. A zero window defaults to five minutes, a nil
+// store to NewMemoryNonceStore and a nil parser to ParseRawData. When manager
+// is a Manager, so is the returned manager.
+func WithReplayProtection(manager GlobalIdentityManager, store NonceStore, window time.Duration, parser RawDataParser) GlobalIdentityManager {
+	if window <= 0 {
+		window = defaultReplayWindow
+	}
+	if store == nil {
+		store = NewMemoryNonceStore()
+	}
+	if parser == nil {
+		parser = ParseRawData
+	}
+	guard := &replayGuard{
+		GlobalIdentityManager: manager,
+		store:                 store,
+		window:                window,
+		parse:                 parser,
+		now:                   time.Now,
+	}
+	if full, ok := manager.(Manager); ok {
+		return &managerReplayGuard{Manager: full, guard: guard}
+	}
+	return guard
+}
+
+// managerReplayGuard keeps the methods of a Manager wrapped by
+// WithReplayProtection.
+type managerReplayGuard struct {
+	Manager
+	guard *replayGuard
+}
+
+func (g *managerReplayGuard) ValidateApplication(clientApplicationKey string, rawData string, encryptedData string) (bool, error) {
+	return g.guard.ValidateApplication(clientApplicationKey, rawData, encryptedData)
+}
+
+func (rg *replayGuard) ValidateApplication(clientApplicationKey string, rawData string, encryptedData string) (bool, error) {
+	timestamp, nonce, err := rg.parse(rawData)
+	if err != nil {
+		return false, err
+	}
+
+	now := rg.now()
+	if timestamp.Before(now.Add(-rg.window)) || timestamp.After(now.Add(rg.window)) {
+		return false, ReplayError("timestamp outside of the accepted window")
+	}
+
+	ok, err := rg.GlobalIdentityManager.ValidateApplication(clientApplicationKey, rawData, encryptedData)
+	if err != nil || !ok {
+		return ok, err
+	}
+
+	fresh, err := rg.store.Use(clientApplicationKey+":"+nonce, timestamp.Add(rg.window))
+	if err != nil {
+		return false, err
+	}
+	if !fresh {
+		return false, ReplayError("nonce already used")
+	}
+
+	return true, nil
+}
@@ -0,0 +1,123 @@
+package authorization
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRawData(t *testing.T) {
+	timestamp, nonce, err := ParseRawData("1562284800:abc:payload")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1562284800), timestamp.Unix())
+	assert.Equal(t, "abc", nonce)
+
+	_, _, err = ParseRawData("1562284800")
+	assert.IsType(t, ReplayError(""), err)
+
+	_, _, err = ParseRawData("now:abc")
+	assert.IsType(t, ReplayError(""), err)
+}
+
+func TestReplayProtection(t *testing.T) {
+	defer leaktest.Check(t)()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", validateApplicationUrl, httpmock.NewStringResponder(http.StatusOK, `{"Success": true, "OperationReport": []}`))
+
+	gim := WithReplayProtection(New("test", globalApplicationUrl), NewMemoryNonceStore(), time.Minute, nil)
+	rawData := fmt.Sprintf("%d:nonce01:data", time.Now().Unix())
+
+	ok, err := gim.ValidateApplication("client", rawData, "signature")
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	ok, err = gim.ValidateApplication("client", rawData, "signature")
+	assert.False(t, ok)
+	assert.Equal(t, ReplayError("nonce already used"), err)
+
+	ok, err = gim.ValidateApplication("other", rawData, "signature")
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	staleData := fmt.Sprintf("%d:nonce02:data", time.Now().Add(-time.Hour).Unix())
+	ok, err = gim.ValidateApplication("client", staleData, "signature")
+	assert.False(t, ok)
+	assert.IsType(t, ReplayError(""), err)
+
+	_, ok = gim.(Manager)
+	assert.True(t, ok, "a wrapped Manager keeps its methods")
+}
+
+func TestReplayProtectionInvalidSignature(t *testing.T) {
+	defer leaktest.Check(t)()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", validateApplicationUrl, httpmock.NewStringResponder(http.StatusOK, `{"Success": false, "OperationReport": [{"Message": "invalid"}]}`))
+
+	store := NewMemoryNonceStore()
+	gim := WithReplayProtection(New("test", globalApplicationUrl), store, time.Minute, nil)
+	rawData := fmt.Sprintf("%d:nonce01:data", time.Now().Unix())
+
+	_, err := gim.ValidateApplication("client", rawData, "signature")
+	assert.NotNil(t, err)
+
+	fresh, _ := store.Use("client:nonce01", time.Now().Add(time.Minute))
+	assert.True(t, fresh)
+}
+
+func TestMemoryNonceStoreExpiration(t *testing.T) {
+	now := time.Now()
+	store := &memoryNonceStore{nonces: make(map[string]time.Time), now: func() time.Time { return now }}
+
+	fresh, _ := store.Use("nonce", now.Add(time.Second))
+	assert.True(t, fresh)
+	fresh, _ = store.Use("nonce", now.Add(time.Second))
+	assert.False(t, fresh)
+
+	now = now.Add(2 * time.Second)
+	fresh, _ = store.Use("nonce", now.Add(time.Second))
+	assert.True(t, fresh)
+}
+
+func TestMemoryNonceStoreSweep(t *testing.T) {
+	now := time.Now()
+	store := &memoryNonceStore{nonces: make(map[string]time.Time), now: func() time.Time { return now }}
+
+	store.Use("a", now.Add(time.Second))
+	now = now.Add(2 * time.Second)
+	store.Use("b", now.Add(time.Hour))
+	assert.Len(t, store.nonces, 2, "expired nonces are kept until the next sweep")
+
+	now = now.Add(memoryNonceSweepInterval)
+	store.Use("c", now.Add(time.Hour))
+	assert.Len(t, store.nonces, 2)
+	_, found := store.nonces["a"]
+	assert.False(t, found)
+}
+
+func TestReplayProtectionNilStore(t *testing.T) {
+	defer leaktest.Check(t)()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", validateApplicationUrl, httpmock.NewStringResponder(http.StatusOK, `{"Success": true, "OperationReport": []}`))
+
+	gim := WithReplayProtection(New("test", globalApplicationUrl), nil, time.Minute, nil)
+	rawData := fmt.Sprintf("%d:nonce01:data", time.Now().Unix())
+
+	ok, err := gim.ValidateApplication("client", rawData, "signature")
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	ok, err = gim.ValidateApplication("client", rawData, "signature")
+	assert.False(t, ok)
+	assert.Equal(t, ReplayError("nonce already used"), err)
+}
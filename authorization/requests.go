@@ -12,6 +12,24 @@ type recoverPasswordRequest struct {
 	Email          string `json:"Email"`
 }
 
+type resetPasswordRequest struct {
+	ApplicationKey string `json:"ApplicationKey"`
+	RecoveryToken  string `json:"RecoveryToken"`
+	NewPassword    string `json:"NewPassword"`
+}
+
+type changePasswordRequest struct {
+	ApplicationKey string `json:"ApplicationKey"`
+	Email          string `json:"Email"`
+	OldPassword    string `json:"OldPassword"`
+	NewPassword    string `json:"NewPassword"`
+}
+
+type validateRecoveryTokenRequest struct {
+	ApplicationKey string `json:"ApplicationKey"`
+	RecoveryToken  string `json:"RecoveryToken"`
+}
+
 type renewTokenRequest struct {
 	ApplicationKey string `json:"ApplicationKey"`
 	Token          string `json:"Token"`
@@ -22,6 +40,16 @@ type validateTokenRequest struct {
 	Token          string `json:"Token"`
 }
 
+type revokeTokenRequest struct {
+	ApplicationKey string `json:"ApplicationKey"`
+	Token          string `json:"Token"`
+}
+
+type revokeUserTokensRequest struct {
+	ApplicationKey string `json:"ApplicationKey"`
+	UserKey        string `json:"UserKey"`
+}
+
 type isUserInHolesRequest struct {
 	ApplicationKey string   `json:"ApplicationKey"`
 	UserKey        string   `json:"UserKey"`
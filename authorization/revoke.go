@@ -0,0 +1,85 @@
+package authorization
+
+import (
+	"errors"
+	"net/http"
+
+	core "github.com/stone-payments/globalidentity-go"
+)
+
+// ErrUnsupported is returned when the Global Identity server does not
+// implement an operation.
+var ErrUnsupported = errors.New("authorization: operation not supported by the server")
+
+// RevocationListener is notified of revocations made through a manager.
+type RevocationListener interface {
+	TokenRevoked(token string)
+	UserTokensRevoked(userKey string)
+}
+
+// RevokeToken revokes token through manager when it is a TokenRevoker, and
+// returns ErrUnsupported otherwise.
+func RevokeToken(manager GlobalIdentityManager, token string) (bool, error) {
+	if revoker, ok := manager.(TokenRevoker); ok {
+		return revoker.RevokeToken(token)
+	}
+	return false, ErrUnsupported
+}
+
+// RevokeUserTokens revokes the tokens of the user through manager when it is
+// a TokenRevoker, and returns ErrUnsupported otherwise.
+func RevokeUserTokens(manager GlobalIdentityManager, userKey string) (bool, error) {
+	if revoker, ok := manager.(TokenRevoker); ok {
+		return revoker.RevokeUserTokens(userKey)
+	}
+	return false, ErrUnsupported
+}
+
+// RevokeToken invalidates a token issued by AuthenticateUser or RenewToken
+// and drops everything the manager remembers about it.
+func (gim *globalIdentityManager) RevokeToken(token string) (bool, error) {
+	revoked, err := gim.revoke(revokeTokenSuffix, &revokeTokenRequest{
+		ApplicationKey: gim.applicationKey,
+		Token:          token,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	gim.stale.forget(ValidateTokenOperation, token)
+	for _, listener := range gim.listeners {
+		listener.TokenRevoked(token)
+	}
+	return revoked, nil
+}
+
+// RevokeUserTokens invalidates every token of the user. It returns
+// ErrUnsupported when the server cannot revoke tokens per user. Since the
+// manager does not know which tokens belong to the user, every remembered
+// validation is dropped.
+func (gim *globalIdentityManager) RevokeUserTokens(userKey string) (bool, error) {
+	revoked, err := gim.revoke(revokeUserTokensSuffix, &revokeUserTokensRequest{
+		ApplicationKey: gim.applicationKey,
+		UserKey:        userKey,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	gim.stale.clear()
+	for _, listener := range gim.listeners {
+		listener.UserTokensRevoked(userKey)
+	}
+	return revoked, nil
+}
+
+func (gim *globalIdentityManager) revoke(suffix string, request interface{}) (bool, error) {
+	revoked, err := gim.post(suffix, request)
+	if giErr, ok := err.(core.GlobalIdentityError); ok {
+		switch giErr.StatusCode() {
+		case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+			return false, ErrUnsupported
+		}
+	}
+	return revoked, err
+}
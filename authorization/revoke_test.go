@@ -0,0 +1,94 @@
+package authorization
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/jarcoal/httpmock"
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	revokeTokenUrl      = "https://dlpgi.dlp-payments.com/api/authorization/revokeToken"
+	revokeUserTokensUrl = "https://dlpgi.dlp-payments.com/api/authorization/revokeUserTokens"
+)
+
+type listenerMock struct {
+	tokens []string
+	users  []string
+}
+
+func (l *listenerMock) TokenRevoked(token string) {
+	l.tokens = append(l.tokens, token)
+}
+
+func (l *listenerMock) UserTokensRevoked(userKey string) {
+	l.users = append(l.users, userKey)
+}
+
+func TestRevokeToken(t *testing.T) {
+	defer leaktest.Check(t)()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	listener := new(listenerMock)
+	gim := New("test", globalApplicationUrl, WithStaleOnError(time.Minute, nil), WithRevocationListener(listener))
+
+	httpmock.RegisterResponder("POST", validateTokenUrl, httpmock.NewStringResponder(http.StatusOK, `{"Success": true, "OperationReport": []}`))
+	_, err := gim.ValidateToken("token")
+	assert.Nil(t, err)
+
+	httpmock.RegisterResponder("POST", revokeTokenUrl, httpmock.NewStringResponder(http.StatusBadGateway, ""))
+	_, err = gim.RevokeToken("token")
+	assert.NotNil(t, err)
+	assert.Empty(t, listener.tokens)
+	assert.Len(t, gim.(*globalIdentityManager).stale.entries, 1, "a failed revocation forgets nothing")
+
+	httpmock.RegisterResponder("POST", revokeTokenUrl, httpmock.NewStringResponder(http.StatusOK, `{"Success": true, "OperationReport": []}`))
+	revoked, err := gim.RevokeToken("token")
+	assert.True(t, revoked)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"token"}, listener.tokens)
+
+	httpmock.RegisterResponder("POST", validateTokenUrl, httpmock.NewErrorResponder(errors.New("connection refused")))
+	_, err = gim.ValidateToken("token")
+	assert.NotNil(t, err)
+
+	httpmock.RegisterResponder("POST", revokeTokenUrl, httpmock.NewStringResponder(http.StatusOK, `{"Success": false, "OperationReport": [{"Message": "invalid token"}]}`))
+	revoked, err = gim.RevokeToken("other")
+	assert.False(t, revoked)
+	assert.Equal(t, core.GlobalIdentityError{"invalid token"}, err)
+	assert.Equal(t, []string{"token"}, listener.tokens)
+}
+
+func TestRevokeUserTokens(t *testing.T) {
+	defer leaktest.Check(t)()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	listener := new(listenerMock)
+	gim := New("test", globalApplicationUrl, WithStaleOnError(time.Minute, nil), WithRevocationListener(listener))
+
+	httpmock.RegisterResponder("POST", isUserInRolesUrl, httpmock.NewStringResponder(http.StatusOK, `{"Success": true, "OperationReport": []}`))
+	_, err := gim.IsUserInRoles("user", "ADMIN")
+	assert.Nil(t, err)
+
+	httpmock.RegisterResponder("POST", revokeUserTokensUrl, httpmock.NewStringResponder(http.StatusOK, `{"Success": true, "OperationReport": []}`))
+	revoked, err := gim.RevokeUserTokens("user")
+	assert.True(t, revoked)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user"}, listener.users)
+
+	httpmock.RegisterResponder("POST", isUserInRolesUrl, httpmock.NewStringResponder(http.StatusBadGateway, ""))
+	_, err = gim.IsUserInRoles("user", "ADMIN")
+	assert.NotNil(t, err)
+
+	httpmock.RegisterResponder("POST", revokeUserTokensUrl, httpmock.NewStringResponder(http.StatusNotFound, ""))
+	_, err = gim.RevokeUserTokens("user")
+	assert.Equal(t, ErrUnsupported, err)
+	assert.Equal(t, []string{"user"}, listener.users)
+}
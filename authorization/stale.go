@@ -0,0 +1,139 @@
+package authorization
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	core "github.com/stone-payments/globalidentity-go"
+)
+
+// Operations reported in StaleEvent.
+const (
+	ValidateTokenOperation = "ValidateToken"
+	IsUserInRolesOperation = "IsUserInRoles"
+)
+
+// StaleEvent describes a stale result served because Global Identity could
+// not be reached. Age is the time since the result was last confirmed and
+// Err is the error that was hidden from the caller.
+type StaleEvent struct {
+	Operation string
+	Age       time.Duration
+	Err       error
+}
+
+// StaleObserver is called every time a stale result is served, so it can be
+// logged or counted. It must not block.
+type StaleObserver func(event StaleEvent)
+
+type staleEntry struct {
+	value interface{}
+	at    time.Time
+}
+
+// staleCache keeps the last successful result of each call for a grace
+// period. A nil staleCache keeps nothing.
+type staleCache struct {
+	grace    time.Duration
+	observer StaleObserver
+	now      func() time.Time
+
+	mutex     sync.Mutex
+	entries   map[[sha256.Size]byte]staleEntry
+	lastSweep time.Time
+}
+
+func newStaleCache(grace time.Duration, observer StaleObserver) *staleCache {
+	return &staleCache{
+		grace:    grace,
+		observer: observer,
+		now:      time.Now,
+		entries:  make(map[[sha256.Size]byte]staleEntry),
+	}
+}
+
+// do runs fn and remembers its result when it succeeds. When Global Identity
+// is unavailable, the result remembered for the same operation and key is
+// returned instead, provided it is not older than the grace period.
+func (c *staleCache) do(operation, key string, fn func() (interface{}, error)) (interface{}, error) {
+	value, err := fn()
+	if c == nil {
+		return value, err
+	}
+
+	id := sha256.Sum256([]byte(operation + "\x00" + key))
+	now := c.now()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err == nil {
+		c.entries[id] = staleEntry{value: value, at: now}
+		c.sweep(now)
+		return value, nil
+	}
+	if _, limited := err.(core.RateLimitedError); limited {
+		// The request was refused locally, which says nothing of the result.
+		return value, err
+	}
+	if !unavailable(err) {
+		delete(c.entries, id)
+		return value, err
+	}
+
+	entry, found := c.entries[id]
+	if !found || now.Sub(entry.at) > c.grace {
+		return value, err
+	}
+	if c.observer != nil {
+		c.observer(StaleEvent{Operation: operation, Age: now.Sub(entry.at), Err: err})
+	}
+	return entry.value, nil
+}
+
+// forget drops the result remembered for the operation and key.
+func (c *staleCache) forget(operation, key string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	delete(c.entries, sha256.Sum256([]byte(operation+"\x00"+key)))
+	c.mutex.Unlock()
+}
+
+// clear drops every remembered result.
+func (c *staleCache) clear() {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	c.entries = make(map[[sha256.Size]byte]staleEntry)
+	c.mutex.Unlock()
+}
+
+// sweep drops expired entries at most once per grace period.
+func (c *staleCache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < c.grace {
+		return
+	}
+	c.lastSweep = now
+	for id, entry := range c.entries {
+		if now.Sub(entry.at) > c.grace {
+			delete(c.entries, id)
+		}
+	}
+}
+
+// unavailable reports whether err means Global Identity could not answer,
+// as opposed to answering negatively.
+func unavailable(err error) bool {
+	switch e := err.(type) {
+	case core.GlobalIdentityError:
+		return e.StatusCode() >= 500
+	case core.RateLimitedError:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,103 @@
+package authorization
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/jarcoal/httpmock"
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithStaleOnError(t *testing.T) {
+	defer leaktest.Check(t)()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var events []StaleEvent
+	gim := New("test", globalApplicationUrl, WithStaleOnError(time.Minute, func(event StaleEvent) {
+		events = append(events, event)
+	}))
+	now := time.Unix(0, 0)
+	gim.(*globalIdentityManager).stale.now = func() time.Time { return now }
+
+	httpmock.RegisterResponder("POST", validateTokenUrl, httpmock.NewStringResponder(http.StatusOK, `{"Success": true, "OperationReport": []}`))
+	httpmock.RegisterResponder("POST", isUserInRolesUrl, httpmock.NewStringResponder(http.StatusOK, `{"Success": true, "OperationReport": []}`))
+
+	ok, err := gim.ValidateToken("token")
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	ok, err = gim.IsUserInRoles("user", "ADMIN")
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	httpmock.RegisterResponder("POST", validateTokenUrl, httpmock.NewStringResponder(http.StatusServiceUnavailable, ""))
+	httpmock.RegisterResponder("POST", isUserInRolesUrl, httpmock.NewErrorResponder(errors.New("connection refused")))
+
+	now = now.Add(30 * time.Second)
+	ok, err = gim.ValidateToken("token")
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	ok, err = gim.IsUserInRoles("user", "ADMIN")
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, ValidateTokenOperation, events[0].Operation)
+		assert.Equal(t, 30*time.Second, events[0].Age)
+		assert.Equal(t, core.GlobalIdentityError{"503"}, events[0].Err)
+		assert.Equal(t, IsUserInRolesOperation, events[1].Operation)
+	}
+
+	_, err = gim.ValidateToken("unknown")
+	assert.Equal(t, core.GlobalIdentityError{"503"}, err)
+	_, err = gim.IsUserInRoles("user", "OTHER")
+	assert.NotNil(t, err)
+
+	now = now.Add(time.Minute)
+	_, err = gim.ValidateToken("token")
+	assert.Equal(t, core.GlobalIdentityError{"503"}, err)
+	assert.Len(t, events, 2)
+}
+
+func TestWithStaleOnErrorRejectedToken(t *testing.T) {
+	defer leaktest.Check(t)()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	gim := New("test", globalApplicationUrl, WithStaleOnError(time.Minute, nil))
+
+	httpmock.RegisterResponder("POST", validateTokenUrl, httpmock.NewStringResponder(http.StatusOK, `{"Success": true, "OperationReport": []}`))
+	_, err := gim.ValidateToken("token")
+	assert.Nil(t, err)
+
+	httpmock.RegisterResponder("POST", validateTokenUrl, httpmock.NewStringResponder(http.StatusOK, `{"Success": false, "OperationReport": [{"Message": "expired"}]}`))
+	_, err = gim.ValidateToken("token")
+	assert.Equal(t, core.GlobalIdentityError{"expired"}, err)
+
+	httpmock.RegisterResponder("POST", validateTokenUrl, httpmock.NewStringResponder(http.StatusInternalServerError, ""))
+	_, err = gim.ValidateToken("token")
+	assert.Equal(t, core.GlobalIdentityError{"500"}, err)
+
+	httpmock.RegisterResponder("POST", validateTokenUrl, httpmock.NewStringResponder(http.StatusUnauthorized, ""))
+	_, err = gim.ValidateToken("token")
+	assert.Equal(t, core.GlobalIdentityError{"401"}, err)
+}
+
+func TestStaleCacheRateLimited(t *testing.T) {
+	cache := newStaleCache(time.Minute, nil)
+	limited := core.RateLimitedError{Class: core.Validation}
+
+	_, err := cache.do(ValidateTokenOperation, "token", func() (interface{}, error) { return true, nil })
+	assert.Nil(t, err)
+
+	_, err = cache.do(ValidateTokenOperation, "token", func() (interface{}, error) { return false, limited })
+	assert.Equal(t, limited, err)
+
+	value, err := cache.do(ValidateTokenOperation, "token", func() (interface{}, error) { return false, errors.New("connection refused") })
+	assert.Nil(t, err)
+	assert.Equal(t, true, value, "a local refusal keeps the remembered result")
+}
@@ -0,0 +1,59 @@
+package globalidentity
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// Binder signs the pairing of a token with the key of the user it was issued
+// to. Global Identity does not tell who a token belongs to when validating
+// it, so a user key sent along with a token can only be trusted when it
+// carries a binding made where the user logged in, by a service sharing the
+// secret.
+type Binder struct {
+	secret []byte
+}
+
+// NewBinder returns a binder signing with secret, which should be at least
+// 32 random bytes shared by the services trusting the bindings.
+func NewBinder(secret []byte) *Binder {
+	return &Binder{secret: append([]byte(nil), secret...)}
+}
+
+// NewRandomBinder returns a binder with a random secret, for bindings that
+// are only verified by the process making them.
+func NewRandomBinder() (*Binder, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return &Binder{secret: secret}, nil
+}
+
+// Bind returns the binding of key to token.
+func (b *Binder) Bind(token, key string) string {
+	return base64.RawURLEncoding.EncodeToString(b.mac(token, key))
+}
+
+// Verify reports whether binding binds key to token. A nil binder verifies
+// no binding.
+func (b *Binder) Verify(token, key, binding string) bool {
+	if b == nil || key == "" || binding == "" {
+		return false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(binding)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(signature, b.mac(token, key))
+}
+
+func (b *Binder) mac(token, key string) []byte {
+	mac := hmac.New(sha256.New, b.secret)
+	mac.Write([]byte(token))
+	mac.Write([]byte{0})
+	mac.Write([]byte(key))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,27 @@
+package globalidentity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBinder(t *testing.T) {
+	binder := NewBinder([]byte("secret"))
+	binding := binder.Bind("token", "user-key")
+
+	assert.True(t, binder.Verify("token", "user-key", binding))
+	assert.False(t, binder.Verify("token", "other-key", binding))
+	assert.False(t, binder.Verify("other-token", "user-key", binding))
+	assert.False(t, binder.Verify("token", "user-key", ""))
+	assert.False(t, binder.Verify("token", "", binder.Bind("token", "")))
+	assert.False(t, binder.Verify("token", "user-key", "not base64!"))
+	assert.False(t, NewBinder([]byte("other")).Verify("token", "user-key", binding))
+
+	random, err := NewRandomBinder()
+	assert.Nil(t, err)
+	assert.False(t, random.Verify("token", "user-key", binding))
+
+	var none *Binder
+	assert.False(t, none.Verify("token", "user-key", binding))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	defaultListen          = ":8080"
+	defaultAuthPrefix      = "/.gi/"
+	defaultDirectory       = 5 * time.Minute
+	defaultShutdownTimeout = 30 * time.Second
+)
+
+// config is the configuration file of the proxy, in YAML or JSON.
+//
+//	listen: ":8080"
+//	upstream: "http://localhost:3000"
+//	host: "https://globalidentity.example.com"
+//	applicationKey: "..."
+//	apiKey: "..."
+//	policy: "policy.yaml"
+//	sessions: "/var/lib/gi-proxy/sessions"
+//	jwks: "https://edge.example.com/.well-known/jwks.json"
+type config struct {
+	// Listen is the address the proxy listens on. It is only read at start.
+	Listen string `yaml:"listen"`
+	// Upstream is the URL requests are forwarded to.
+	Upstream string `yaml:"upstream"`
+	// Host, ApplicationKey and APIKey reach Global Identity. They default to
+	// the GI_HOST, GI_APPLICATION_KEY and GI_API_KEY environment variables.
+	// Without an API key the X-User-Email and X-User-Roles headers are not
+	// set.
+	Host           string `yaml:"host"`
+	ApplicationKey string `yaml:"applicationKey"`
+	APIKey         string `yaml:"apiKey"`
+	// Policy is the policy file enforced on every request.
+	Policy string `yaml:"policy"`
+	// AuthPrefix is where the login, logout, renew and recover endpoints are
+	// served. It defaults to "/.gi/".
+	AuthPrefix string `yaml:"authPrefix"`
+	// Sessions, when set, is the directory sessions are kept in, so the
+	// user key of a session is known to the proxy rather than sent by the
+	// client.
+	Sessions string `yaml:"sessions"`
+	// JWKS, when set, is the key set URL bearer JWTs minted by the jwt
+	// package are verified against. Their claims are trusted without any
+	// call to Global Identity.
+	JWKS     string `yaml:"jwks"`
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	// DirectoryRefresh is how often users are reloaded to resolve emails
+	// and roles. It defaults to 5 minutes.
+	DirectoryRefresh time.Duration `yaml:"directoryRefresh"`
+	// ShutdownTimeout bounds how long in-flight requests are waited for on
+	// shutdown. It defaults to 30 seconds.
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+	// Insecure drops the Secure attribute of the cookies.
+	Insecure bool `yaml:"insecure"`
+	// BindingSecret signs the user key cookie, binding it to the token
+	// cookie, and the X-User-Binding header of bearer tokens. Proxies sharing
+	// cookies must share it; when empty a random secret is used and only the
+	// cookies set by this process are trusted.
+	BindingSecret string `yaml:"bindingSecret"`
+}
+
+func loadConfig(filename string) (*config, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &config{
+		Listen:           defaultListen,
+		Host:             os.Getenv("GI_HOST"),
+		ApplicationKey:   os.Getenv("GI_APPLICATION_KEY"),
+		APIKey:           os.Getenv("GI_API_KEY"),
+		AuthPrefix:       defaultAuthPrefix,
+		DirectoryRefresh: defaultDirectory,
+		ShutdownTimeout:  defaultShutdownTimeout,
+	}
+	// JSON is a subset of YAML, so both are decoded the same way.
+	if err = yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if err = cfg.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return cfg, nil
+}
+
+func (c *config) validate() error {
+	if c.Upstream == "" {
+		return fmt.Errorf("upstream is required")
+	}
+	upstream, err := url.Parse(c.Upstream)
+	if err != nil || upstream.Scheme == "" || upstream.Host == "" {
+		return fmt.Errorf("invalid upstream %q", c.Upstream)
+	}
+	if c.Host == "" || c.ApplicationKey == "" {
+		return fmt.Errorf("host and application key are required")
+	}
+	if c.Policy == "" {
+		return fmt.Errorf("policy is required")
+	}
+	if c.AuthPrefix == "" || c.AuthPrefix[0] != '/' || c.AuthPrefix[len(c.AuthPrefix)-1] != '/' {
+		return fmt.Errorf("authPrefix must start and end with a slash")
+	}
+	return nil
+}
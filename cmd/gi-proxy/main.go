@@ -0,0 +1,132 @@
+// Command gi-proxy is a reverse proxy authenticating requests with Global
+// Identity in front of applications that know nothing about it.
+//
+// Every request must carry a valid token, in the session cookies set by the
+// endpoints served under /.gi/, as a bearer token with the user key in the
+// X-User-Key header and its binding to the token, signed with the binding
+// secret, in the X-User-Binding header, or as a bearer JWT minted by the jwt
+// package. X-User-* headers sent by clients are always dropped. Requests
+// allowed by the policy file are forwarded without their credentials and
+// with the X-User-Key, X-User-Email and X-User-Roles headers set.
+//
+// The configuration file is read again on SIGHUP; the listen address only
+// changes on restart. SIGINT and SIGTERM stop accepting connections and wait
+// for the requests in flight.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+func main() {
+	filename := flag.String("config", "gi-proxy.yaml", "configuration file (YAML or JSON)")
+	flag.Parse()
+
+	if err := run(*filename); err != nil {
+		fmt.Fprintln(os.Stderr, "gi-proxy:", err)
+		os.Exit(1)
+	}
+}
+
+func run(filename string) error {
+	cfg, err := loadConfig(filename)
+	if err != nil {
+		return err
+	}
+	current, err := build(cfg)
+	if err != nil {
+		return err
+	}
+	handler := &reloadable{current: current}
+	defer handler.close()
+
+	server := &http.Server{Addr: cfg.Listen, Handler: handler}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+	log.Printf("gi-proxy: listening on %s, forwarding to %s", cfg.Listen, cfg.Upstream)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case err := <-errs:
+			return err
+		case received := <-signals:
+			if received == syscall.SIGHUP {
+				if err := handler.reload(filename); err != nil {
+					log.Printf("gi-proxy: reloading %s: %v", filename, err)
+				} else {
+					log.Printf("gi-proxy: reloaded %s", filename)
+				}
+				continue
+			}
+
+			log.Printf("gi-proxy: shutting down")
+			ctx, cancel := context.WithTimeout(context.Background(), handler.config().ShutdownTimeout)
+			err := server.Shutdown(ctx)
+			cancel()
+			return err
+		}
+	}
+}
+
+// reloadable serves with the proxy built from the latest configuration.
+type reloadable struct {
+	mutex   sync.RWMutex
+	current *proxy
+}
+
+func (h *reloadable) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mutex.RLock()
+	current := h.current
+	h.mutex.RUnlock()
+	current.ServeHTTP(w, r)
+}
+
+func (h *reloadable) config() *config {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.current.config
+}
+
+// reload replaces the proxy with one built from the configuration file. The
+// proxy in use is kept when the file cannot be loaded.
+func (h *reloadable) reload(filename string) error {
+	cfg, err := loadConfig(filename)
+	if err != nil {
+		return err
+	}
+	if listen := h.config().Listen; cfg.Listen != listen {
+		log.Printf("gi-proxy: still listening on %s until restarted", listen)
+		cfg.Listen = listen
+	}
+	next, err := build(cfg)
+	if err != nil {
+		return err
+	}
+
+	h.mutex.Lock()
+	previous := h.current
+	h.current = next
+	h.mutex.Unlock()
+	previous.close()
+	return nil
+}
+
+func (h *reloadable) close() {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	h.current.close()
+}
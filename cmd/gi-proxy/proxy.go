@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stone-payments/globalidentity-go/authorization"
+	gihttp "github.com/stone-payments/globalidentity-go/http"
+	"github.com/stone-payments/globalidentity-go/jwt/verifier"
+	"github.com/stone-payments/globalidentity-go/management"
+	"github.com/stone-payments/globalidentity-go/policy"
+	"github.com/stone-payments/globalidentity-go/session"
+)
+
+const (
+	tokenCookie   = "gi_token"
+	userCookie    = "gi_user"
+	sessionCookie = "gi_session"
+	jwksRefresh   = 10 * time.Minute
+
+	headerPrefix  = "X-User-"
+	keyHeader     = "X-User-Key"
+	bindingHeader = "X-User-Binding"
+	emailHeader   = "X-User-Email"
+	rolesHeader   = "X-User-Roles"
+)
+
+// identity is the authenticated user of a request. roles is nil when
+// unknown; trusted reports that the roles come from a verified JWT and may
+// be used for authorization without calling Global Identity.
+type identity struct {
+	key     string
+	email   string
+	roles   []string
+	trusted bool
+}
+
+// proxy authenticates and authorizes requests before forwarding them
+// upstream with the X-User-* headers.
+type proxy struct {
+	config    *config
+	manager   authorization.Manager
+	handlers  *gihttp.Handlers
+	binder    *core.Binder
+	engine    *policy.Engine
+	directory *management.Directory
+	tokens    *verifier.Verifier
+	upstream  *httputil.ReverseProxy
+	mux       *http.ServeMux
+}
+
+// build returns the proxy configured by cfg, connected to Global Identity.
+func build(cfg *config) (*proxy, error) {
+	manager := authorization.New(cfg.ApplicationKey, cfg.Host)
+
+	var sessions *session.Manager
+	if cfg.Sessions != "" {
+		store, err := session.NewFileStore(cfg.Sessions)
+		if err != nil {
+			return nil, err
+		}
+		sessions = session.NewManager(store, manager, session.Options{})
+	}
+
+	var tokens *verifier.Verifier
+	if cfg.JWKS != "" {
+		keys := verifier.NewRemoteKeys(cfg.JWKS, nil, jwksRefresh)
+		tokens = verifier.New(keys, verifier.Options{Issuer: cfg.Issuer, Audience: cfg.Audience})
+	}
+
+	var directory *management.Directory
+	if cfg.APIKey != "" {
+		users := management.New(cfg.ApplicationKey, cfg.APIKey, cfg.Host)
+		directory = management.NewDirectory(users, cfg.DirectoryRefresh, true)
+	}
+
+	p, err := newProxy(cfg, manager, sessions, directory, tokens)
+	if err != nil {
+		return nil, err
+	}
+	if directory != nil {
+		if err = directory.Start(); err != nil {
+			log.Printf("gi-proxy: loading users: %v", err)
+		}
+	}
+	return p, nil
+}
+
+func newProxy(cfg *config, manager authorization.Manager, sessions *session.Manager, directory *management.Directory, tokens *verifier.Verifier) (*proxy, error) {
+	engine, err := policy.LoadEngine(cfg.Policy, manager)
+	if err != nil {
+		return nil, err
+	}
+	target, err := url.Parse(cfg.Upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	token := tokenCookie
+	if sessions != nil {
+		token = sessionCookie
+	}
+	binder, err := newBinder(cfg)
+	if err != nil {
+		return nil, err
+	}
+	p := &proxy{
+		config:  cfg,
+		manager: manager,
+		handlers: gihttp.New(gihttp.Config{
+			Manager:       manager,
+			TokenCookie:   token,
+			UserCookie:    userCookie,
+			Binder:        binder,
+			Insecure:      cfg.Insecure,
+			Sessions:      sessions,
+			LoginRedirect: "/",
+		}),
+		binder:    binder,
+		engine:    engine,
+		directory: directory,
+		tokens:    tokens,
+		upstream:  httputil.NewSingleHostReverseProxy(target),
+		mux:       http.NewServeMux(),
+	}
+	p.mux.Handle(cfg.AuthPrefix, http.StripPrefix(strings.TrimSuffix(cfg.AuthPrefix, "/"), p.handlers.Handler()))
+	p.mux.HandleFunc("/", p.forward)
+	return p, nil
+}
+
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mux.ServeHTTP(w, r)
+}
+
+var (
+	randomBinder     *core.Binder
+	randomBinderErr  error
+	randomBinderOnce sync.Once
+)
+
+// newBinder returns the binder signing user keys, random unless configured.
+// The random binder is kept across reloads so they do not log users out.
+func newBinder(cfg *config) (*core.Binder, error) {
+	if cfg.BindingSecret != "" {
+		return core.NewBinder([]byte(cfg.BindingSecret)), nil
+	}
+	randomBinderOnce.Do(func() {
+		randomBinder, randomBinderErr = core.NewRandomBinder()
+	})
+	return randomBinder, randomBinderErr
+}
+
+// close stops refreshing users once the proxy has been replaced.
+func (p *proxy) close() {
+	if p.directory != nil {
+		p.directory.Stop()
+	}
+}
+
+func (p *proxy) forward(w http.ResponseWriter, r *http.Request) {
+	user, status := p.authenticate(r, stripUserHeaders(r))
+	if status != http.StatusOK {
+		writeError(w, status)
+		return
+	}
+
+	target := policy.HTTPTarget(r.Method, r.URL.Path)
+	var allowed bool
+	if user.trusted {
+		allowed = p.engine.AuthorizeRoles(target, user.roles...)
+	} else {
+		var err error
+		if allowed, err = p.engine.Authorize(target, user.key); err != nil {
+			writeError(w, failure(err))
+			return
+		}
+	}
+	if !allowed {
+		writeError(w, http.StatusForbidden)
+		return
+	}
+
+	stripCredentials(r)
+	r.Header.Set(keyHeader, user.key)
+	if user.email != "" {
+		r.Header.Set(emailHeader, user.email)
+	}
+	if user.roles != nil {
+		roles := append([]string(nil), user.roles...)
+		sort.Strings(roles)
+		r.Header.Set(rolesHeader, strings.Join(roles, ","))
+	}
+	p.upstream.ServeHTTP(w, r)
+}
+
+// authenticate finds the user of r from a bearer JWT, a bearer Global
+// Identity token with the user key in the X-User-Key header of claimed, or
+// the session cookies. The key of a bearer token is only trusted when the
+// X-User-Binding header binds it to the token with the binding secret.
+// Global Identity tokens are validated on every request.
+func (p *proxy) authenticate(r *http.Request, claimed http.Header) (*identity, int) {
+	var current *core.Authorization
+	if token := bearerToken(r); token != "" {
+		if p.tokens != nil && strings.Count(token, ".") == 2 {
+			claims, err := p.tokens.Verify(token)
+			if err != nil {
+				return nil, http.StatusUnauthorized
+			}
+			user := &identity{key: claims.Subject, roles: claims.Roles, trusted: true}
+			if user.roles == nil {
+				user.roles = []string{}
+			}
+			p.lookup(user)
+			return user, http.StatusOK
+		}
+		key := claimed.Get(keyHeader)
+		if !p.binder.Verify(token, key, claimed.Get(bindingHeader)) {
+			return nil, http.StatusUnauthorized
+		}
+		current = &core.Authorization{Token: token, Key: key}
+	} else {
+		var ok bool
+		if current, ok = p.handlers.Authorization(r); !ok {
+			return nil, http.StatusUnauthorized
+		}
+	}
+	if current.Key == "" {
+		return nil, http.StatusUnauthorized
+	}
+
+	if valid, err := p.manager.ValidateToken(current.Token); err != nil {
+		return nil, failure(err)
+	} else if !valid {
+		return nil, http.StatusUnauthorized
+	}
+
+	user := &identity{key: current.Key}
+	if found := p.lookup(user); found && user.roles == nil {
+		user.roles = []string{}
+	}
+	return user, http.StatusOK
+}
+
+// lookup fills the email of the user and, unless already known, its roles
+// from the directory.
+func (p *proxy) lookup(user *identity) bool {
+	if p.directory == nil {
+		return false
+	}
+	found, ok := p.directory.ByKey(user.key)
+	if !ok {
+		return false
+	}
+	user.email = found.Email
+	if user.roles == nil {
+		user.roles = found.Roles
+	}
+	return true
+}
+
+// stripUserHeaders removes the X-User-* headers sent by the client, before
+// anything else reads the request, and returns them. Names are matched
+// regardless of case and with underscores taken as dashes, since some
+// upstream servers treat X_User_Key as X-User-Key.
+func stripUserHeaders(r *http.Request) http.Header {
+	prefix := strings.ToLower(headerPrefix)
+	claimed := make(http.Header)
+	for name, values := range r.Header {
+		if strings.HasPrefix(strings.ToLower(strings.Replace(name, "_", "-", -1)), prefix) {
+			claimed[name] = values
+			delete(r.Header, name)
+		}
+	}
+	return claimed
+}
+
+// stripCredentials removes what authenticated the request before it is
+// forwarded.
+func stripCredentials(r *http.Request) {
+	r.Header.Del("Authorization")
+
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	var kept []string
+	for _, cookie := range cookies {
+		switch cookie.Name {
+		case tokenCookie, userCookie, sessionCookie:
+		default:
+			kept = append(kept, cookie.String())
+		}
+	}
+	if len(kept) > 0 {
+		r.Header.Set("Cookie", strings.Join(kept, "; "))
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) <= 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(header[7:])
+}
+
+// failure maps an error of Global Identity to 401, for rejected tokens, or
+// 503.
+func failure(err error) int {
+	if giErr, ok := err.(core.GlobalIdentityError); ok && giErr.StatusCode() < http.StatusInternalServerError {
+		return http.StatusUnauthorized
+	}
+	return http.StatusServiceUnavailable
+}
+
+var errorCodes = map[int]string{
+	http.StatusUnauthorized:       gihttp.ErrUnauthenticated,
+	http.StatusForbidden:          "forbidden",
+	http.StatusServiceUnavailable: gihttp.ErrUnavailable,
+}
+
+func writeError(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": errorCodes[status]})
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stone-payments/globalidentity-go/authorization"
+	"github.com/stone-payments/globalidentity-go/jwt"
+	"github.com/stone-payments/globalidentity-go/jwt/verifier"
+	"github.com/stone-payments/globalidentity-go/management"
+	"github.com/stone-payments/globalidentity-go/management/managementtest"
+	"github.com/stretchr/testify/assert"
+)
+
+const testPolicy = `
+rules:
+  - path: /admin/**
+    roles: [admin]
+  - path: /**
+`
+
+var binder = core.NewBinder([]byte("secret"))
+
+type managerMock struct {
+	authorization.Manager
+	err   error
+	roles map[string][]string
+}
+
+func (m *managerMock) ValidateToken(token string) (bool, error) {
+	if m.err != nil {
+		return false, m.err
+	}
+	if token == "expired" {
+		return false, nil
+	}
+	if token != "token" {
+		return false, core.GlobalIdentityError{"invalid token"}
+	}
+	return true, nil
+}
+
+func (m *managerMock) HasAnyRole(userKey string, roles ...string) (bool, error) {
+	for _, held := range m.roles[userKey] {
+		for _, role := range roles {
+			if held == role {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (m *managerMock) HasAllRoles(userKey string, roles ...string) (bool, error) {
+	return false, nil
+}
+
+type fixture struct {
+	proxy    *proxy
+	manager  *managerMock
+	key      *jwt.Key
+	upstream *http.Request
+	close    func()
+}
+
+func newFixture(t *testing.T) *fixture {
+	dir, err := ioutil.TempDir("", "gi-proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "policy.yaml")
+	if err = ioutil.WriteFile(filename, []byte(testPolicy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fixture{manager: &managerMock{roles: map[string][]string{"admin-key": {"admin"}}}}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.upstream = r
+	}))
+	f.close = func() {
+		upstream.Close()
+		os.RemoveAll(dir)
+	}
+
+	users := managementtest.New(
+		core.User{UserKey: "admin-key", Email: "admin@test.com", Roles: []string{"viewer", "admin"}},
+		core.User{UserKey: "user-key", Email: "user@test.com"},
+	)
+	directory := management.NewDirectory(users, time.Hour, true)
+	assert.Nil(t, directory.Refresh())
+
+	if f.key, err = jwt.GenerateKey(jwt.EdDSA); err != nil {
+		t.Fatal(err)
+	}
+	tokens := verifier.New(verifier.StaticKeys(jwt.JWKS{Keys: []jwt.JWK{f.key.JWK()}}), verifier.Options{Issuer: "edge"})
+
+	cfg := &config{Upstream: upstream.URL, Policy: filename, AuthPrefix: defaultAuthPrefix, BindingSecret: "secret"}
+	if f.proxy, err = newProxy(cfg, f.manager, nil, directory, tokens); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// bearer returns the headers of a bearer token with a user key bound to it.
+func bearer(token, key string) map[string]string {
+	return map[string]string{"Authorization": "Bearer " + token, keyHeader: key, bindingHeader: binder.Bind(token, key)}
+}
+
+func (f *fixture) serve(path string, headers map[string]string, cookies ...*http.Cookie) int {
+	f.upstream = nil
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	recorder := httptest.NewRecorder()
+	f.proxy.ServeHTTP(recorder, req)
+	return recorder.Code
+}
+
+func TestForwardWithCookies(t *testing.T) {
+	f := newFixture(t)
+	defer f.close()
+
+	status := f.serve("/admin/users", map[string]string{"X-User-Roles": "forged"},
+		&http.Cookie{Name: tokenCookie, Value: "token"},
+		&http.Cookie{Name: userCookie, Value: "admin-key." + binder.Bind("token", "admin-key")},
+		&http.Cookie{Name: "theme", Value: "dark"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "admin-key", f.upstream.Header.Get(keyHeader))
+	assert.Equal(t, "admin@test.com", f.upstream.Header.Get(emailHeader))
+	assert.Equal(t, "admin,viewer", f.upstream.Header.Get(rolesHeader))
+	assert.Equal(t, "theme=dark", f.upstream.Header.Get("Cookie"))
+}
+
+func TestForwardWithForgedCookie(t *testing.T) {
+	f := newFixture(t)
+	defer f.close()
+
+	status := f.serve("/admin/users", nil,
+		&http.Cookie{Name: tokenCookie, Value: "token"},
+		&http.Cookie{Name: userCookie, Value: "admin-key." + binder.Bind("token", "user-key")})
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Nil(t, f.upstream)
+}
+
+func TestForwardWithBearerToken(t *testing.T) {
+	f := newFixture(t)
+	defer f.close()
+
+	headers := bearer("token", "user-key")
+	headers[emailHeader] = "admin@test.com"
+	status := f.serve("/orders", headers)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "", f.upstream.Header.Get("Authorization"))
+	assert.Equal(t, "", f.upstream.Header.Get(bindingHeader))
+	assert.Equal(t, "user-key", f.upstream.Header.Get(keyHeader))
+	assert.Equal(t, "user@test.com", f.upstream.Header.Get(emailHeader))
+	_, ok := f.upstream.Header[rolesHeader]
+	assert.True(t, ok, "users without roles get an empty header")
+	assert.Equal(t, "", f.upstream.Header.Get("Cookie"))
+}
+
+func TestForwardWithMismatchedBearerKey(t *testing.T) {
+	f := newFixture(t)
+	defer f.close()
+
+	for _, binding := range []string{
+		"",
+		binder.Bind("token", "user-key"),
+		binder.Bind("other", "admin-key"),
+		core.NewBinder([]byte("other")).Bind("token", "admin-key"),
+	} {
+		status := f.serve("/admin/users", map[string]string{"Authorization": "Bearer token", keyHeader: "admin-key", bindingHeader: binding})
+		assert.Equal(t, http.StatusUnauthorized, status, binding)
+		assert.Nil(t, f.upstream)
+	}
+}
+
+func TestForwardWithInvalidToken(t *testing.T) {
+	f := newFixture(t)
+	defer f.close()
+
+	status := f.serve("/orders", nil,
+		&http.Cookie{Name: tokenCookie, Value: "expired"},
+		&http.Cookie{Name: userCookie, Value: "user-key." + binder.Bind("expired", "user-key")})
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Nil(t, f.upstream)
+}
+
+func TestStripUserHeaders(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header["X-User-Key"] = []string{"admin-key"}
+	req.Header["X_User_Roles"] = []string{"admin"}
+	req.Header["x_user_email"] = []string{"admin@test.com"}
+	req.Header["x-user-binding"] = []string{"forged"}
+	req.Header["X-Request-Id"] = []string{"1"}
+	req.Header["X_Request_Id"] = []string{"2"}
+
+	claimed := stripUserHeaders(req)
+	assert.Equal(t, http.Header{"X-Request-Id": {"1"}, "X_Request_Id": {"2"}}, req.Header)
+	assert.Len(t, claimed, 4)
+	assert.Equal(t, "admin-key", claimed.Get(keyHeader))
+}
+
+func TestForwardWithUnderscoreHeaders(t *testing.T) {
+	f := newFixture(t)
+	defer f.close()
+
+	headers := bearer("token", "user-key")
+	headers["X_User_Roles"] = "admin"
+	headers["X_User_Email"] = "admin@test.com"
+	status := f.serve("/orders", headers)
+	assert.Equal(t, http.StatusOK, status)
+	for name := range f.upstream.Header {
+		assert.NotContains(t, name, "_", "underscore variants of the user headers are not forwarded")
+	}
+	assert.Equal(t, "user@test.com", f.upstream.Header.Get(emailHeader))
+}
+
+func TestForwardWithJWT(t *testing.T) {
+	f := newFixture(t)
+	defer f.close()
+	now := time.Now().Unix()
+	sign := func(roles ...string) string {
+		token, err := jwt.Sign(f.key, &jwt.Claims{Issuer: "edge", Subject: "user-key", IssuedAt: now, ExpiresAt: now + 60, Roles: roles})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	status := f.serve("/admin", map[string]string{"Authorization": "Bearer " + sign("admin"), rolesHeader: "forged"})
+	assert.Equal(t, http.StatusOK, status, "roles of the claims are trusted")
+	assert.Equal(t, "user-key", f.upstream.Header.Get(keyHeader))
+	assert.Equal(t, "user@test.com", f.upstream.Header.Get(emailHeader))
+	assert.Equal(t, "admin", f.upstream.Header.Get(rolesHeader))
+
+	assert.Equal(t, http.StatusForbidden, f.serve("/admin", map[string]string{"Authorization": "Bearer " + sign()}))
+	assert.Equal(t, http.StatusUnauthorized, f.serve("/", map[string]string{"Authorization": "Bearer a.b.c"}))
+}
+
+func TestRefused(t *testing.T) {
+	f := newFixture(t)
+	defer f.close()
+
+	assert.Equal(t, http.StatusUnauthorized, f.serve("/", nil))
+	assert.Equal(t, http.StatusUnauthorized, f.serve("/", map[string]string{"Authorization": "Bearer token"}))
+	assert.Equal(t, http.StatusUnauthorized, f.serve("/", bearer("expired", "user-key")))
+	assert.Equal(t, http.StatusForbidden, f.serve("/admin/users", bearer("token", "user-key")))
+
+	f.manager.err = core.GlobalIdentityError{"503"}
+	assert.Equal(t, http.StatusServiceUnavailable, f.serve("/", bearer("token", "user-key")))
+	assert.Nil(t, f.upstream)
+}
+
+func TestAuthEndpoints(t *testing.T) {
+	f := newFixture(t)
+	defer f.close()
+
+	assert.Equal(t, http.StatusMethodNotAllowed, f.serve("/.gi/login", nil))
+	assert.Nil(t, f.upstream)
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gi-proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(content string) string {
+		filename := filepath.Join(dir, "config.yaml")
+		if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+
+	cfg, err := loadConfig(write(`
+upstream: http://localhost:3000
+host: https://gi.test.com
+applicationKey: app
+policy: policy.yaml
+directoryRefresh: 1m
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, defaultListen, cfg.Listen)
+	assert.Equal(t, defaultAuthPrefix, cfg.AuthPrefix)
+	assert.Equal(t, time.Minute, cfg.DirectoryRefresh)
+	assert.Equal(t, defaultShutdownTimeout, cfg.ShutdownTimeout)
+
+	_, err = loadConfig(write(`{"upstream": "http://localhost:3000", "host": "https://gi.test.com", "applicationKey": "app", "policy": "policy.yaml"}`))
+	assert.Nil(t, err)
+
+	_, err = loadConfig(write(`upstream: localhost`))
+	assert.NotNil(t, err)
+	_, err = loadConfig(write(`unknown: true`))
+	assert.NotNil(t, err)
+}
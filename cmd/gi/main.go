@@ -0,0 +1,52 @@
+// Command gi manages a Global Identity application from the command line.
+//
+// The host and keys are read from the -host, -application-key and -api-key
+// flags of each subcommand, defaulting to the GI_HOST, GI_APPLICATION_KEY and
+// GI_API_KEY environment variables.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/stone-payments/globalidentity-go/management"
+)
+
+var commands = map[string]func(args []string) error{
+	"reconcile": reconcileCommand,
+}
+
+func main() {
+	if len(os.Args) < 2 || commands[os.Args[1]] == nil {
+		fmt.Fprintln(os.Stderr, "usage: gi <command> [arguments]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "commands:")
+		fmt.Fprintln(os.Stderr, "  reconcile plan|apply   bring users and roles to a desired state")
+		os.Exit(2)
+	}
+
+	if err := commands[os.Args[1]](os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "gi:", err)
+		os.Exit(1)
+	}
+}
+
+type connection struct {
+	host           string
+	applicationKey string
+	apiKey         string
+}
+
+func (c *connection) register(flags *flag.FlagSet) {
+	flags.StringVar(&c.host, "host", os.Getenv("GI_HOST"), "Global Identity host")
+	flags.StringVar(&c.applicationKey, "application-key", os.Getenv("GI_APPLICATION_KEY"), "application key")
+	flags.StringVar(&c.apiKey, "api-key", os.Getenv("GI_API_KEY"), "management API key")
+}
+
+func (c *connection) management() (management.Manager, error) {
+	if c.host == "" || c.applicationKey == "" || c.apiKey == "" {
+		return nil, fmt.Errorf("host, application key and API key are required")
+	}
+	return management.New(c.applicationKey, c.apiKey, c.host), nil
+}
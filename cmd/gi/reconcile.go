@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/stone-payments/globalidentity-go/reconcile"
+)
+
+func reconcileCommand(args []string) error {
+	if len(args) < 1 || (args[0] != "plan" && args[0] != "apply") {
+		return fmt.Errorf("usage: gi reconcile plan|apply -state file [flags]")
+	}
+	mode := args[0]
+
+	flags := flag.NewFlagSet("reconcile "+mode, flag.ExitOnError)
+	var conn connection
+	conn.register(flags)
+	stateFile := flags.String("state", "", "desired state file (YAML or JSON)")
+	concurrency := flags.Int("concurrency", 4, "users changed at the same time")
+	dryRun := flags.Bool("dry-run", false, "print the plan without applying it")
+	flags.Parse(args[1:])
+
+	if *stateFile == "" {
+		return fmt.Errorf("-state is required")
+	}
+	state, err := reconcile.LoadState(*stateFile)
+	if err != nil {
+		return err
+	}
+
+	manager, err := conn.management()
+	if err != nil {
+		return err
+	}
+
+	plan, err := reconcile.Diff(state, manager)
+	if err != nil {
+		return err
+	}
+	fmt.Print(plan)
+
+	if mode == "plan" || plan.Empty() {
+		return nil
+	}
+
+	report := reconcile.Apply(plan, manager, reconcile.Options{Concurrency: *concurrency, DryRun: *dryRun})
+	for _, result := range report.Failed() {
+		fmt.Fprintf(os.Stderr, "failed: %s: %v\n", result.Action, result.Err)
+	}
+	if failed := len(report.Failed()); failed > 0 {
+		return fmt.Errorf("%d of %d actions failed", failed, len(report.Results))
+	}
+
+	if *dryRun {
+		fmt.Println("Dry run: no changes applied.")
+	} else {
+		fmt.Printf("Applied %d actions.\n", len(report.Results))
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package globalidentity
+
+import "context"
+
+type authorizationKey struct{}
+
+// NewContext returns a copy of ctx carrying the authorization.
+func NewContext(ctx context.Context, authorization *Authorization) context.Context {
+	return context.WithValue(ctx, authorizationKey{}, authorization)
+}
+
+// FromContext returns the authorization stored in ctx, if any.
+func FromContext(ctx context.Context) (*Authorization, bool) {
+	authorization, ok := ctx.Value(authorizationKey{}).(*Authorization)
+	return authorization, ok && authorization != nil
+}
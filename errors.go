@@ -1,9 +1,25 @@
 package globalidentity
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+)
 
 type GlobalIdentityError []string
 
 func (e GlobalIdentityError) Error() string {
 	return fmt.Sprintf("%#v", []string(e))
 }
+
+// StatusCode returns the HTTP status of the response the error was created
+// for, or 0 when the error carries Global Identity messages instead.
+func (e GlobalIdentityError) StatusCode() int {
+	if len(e) != 1 || len(e[0]) != 3 {
+		return 0
+	}
+	status, err := strconv.Atoi(e[0])
+	if err != nil {
+		return 0
+	}
+	return status
+}
@@ -0,0 +1,319 @@
+package globalidentity
+
+import (
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxFailures   = 3
+	defaultEjectionTime  = 30 * time.Second
+	defaultProbeInterval = 10 * time.Second
+)
+
+// Endpoint is a Global Identity host. When every endpoint has the same
+// weight they are tried in order; otherwise a healthy endpoint is picked at
+// random in proportion to its weight.
+type Endpoint struct {
+	Host   string
+	Weight int
+}
+
+// FailoverOptions controls how endpoints are ejected and restored.
+type FailoverOptions struct {
+	// MaxFailures is the number of consecutive failures, connection errors or
+	// 5xx responses, after which an endpoint is ejected. It defaults to 3.
+	MaxFailures int
+	// EjectionTime is how long an endpoint stays ejected unless a probe
+	// succeeds first. It defaults to 30 seconds.
+	EjectionTime time.Duration
+	// ProbeInterval is how often ejected endpoints are probed. It defaults to
+	// 10 seconds.
+	ProbeInterval time.Duration
+	// ProbePath is requested with GET on ejected endpoints; any response below
+	// 500 restores the endpoint. It defaults to "/".
+	ProbePath string
+	// RetryNonIdempotent also retries POST requests that change data on
+	// another endpoint after a 502, 503 or 504 response or a connection error,
+	// when the first endpoint may have handled them. Without it such requests
+	// are only retried when they could not be sent at all.
+	RetryNonIdempotent bool
+}
+
+type endpointState struct {
+	Endpoint
+	failures     int
+	ejectedUntil time.Time
+}
+
+// FailoverRequester sends requests to one of several endpoints. Requests
+// whose url is a path, such as those of managers created with an empty host,
+// are sent to the current endpoint, which is kept for as long as it stays
+// healthy. Connection errors and 502, 503 and 504 responses are retried on
+// the next endpoint for GET, PUT and DELETE requests and for Validation
+// requests; other POST requests are only retried when they could not be sent,
+// unless RetryNonIdempotent is set.
+type FailoverRequester struct {
+	next    Requester
+	options FailoverOptions
+	now     func() time.Time
+
+	mutex     sync.Mutex
+	endpoints []*endpointState
+	current   int
+	weighted  bool
+	probing   bool
+	closed    bool
+	done      chan struct{}
+}
+
+// NewFailoverRequester returns a FailoverRequester sending requests through
+// next to the endpoints.
+func NewFailoverRequester(endpoints []Endpoint, next Requester, options FailoverOptions) *FailoverRequester {
+	if options.MaxFailures <= 0 {
+		options.MaxFailures = defaultMaxFailures
+	}
+	if options.EjectionTime <= 0 {
+		options.EjectionTime = defaultEjectionTime
+	}
+	if options.ProbeInterval <= 0 {
+		options.ProbeInterval = defaultProbeInterval
+	}
+	if options.ProbePath == "" {
+		options.ProbePath = "/"
+	}
+
+	f := &FailoverRequester{
+		next:    next,
+		options: options,
+		now:     time.Now,
+		done:    make(chan struct{}),
+	}
+	for _, endpoint := range endpoints {
+		f.endpoints = append(f.endpoints, &endpointState{Endpoint: endpoint})
+		if endpoint.Weight != endpoints[0].Weight {
+			f.weighted = true
+		}
+	}
+	if f.weighted {
+		f.current = f.pick(-1)
+	}
+	return f
+}
+
+// Hosts builds equally weighted endpoints, tried in the given order.
+func Hosts(hosts ...string) []Endpoint {
+	endpoints := make([]Endpoint, len(hosts))
+	for i, host := range hosts {
+		endpoints[i] = Endpoint{Host: host, Weight: 1}
+	}
+	return endpoints
+}
+
+// Close stops probing ejected endpoints.
+func (f *FailoverRequester) Close() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if !f.closed {
+		f.closed = true
+		close(f.done)
+	}
+}
+
+// Current returns the host requests are currently sent to.
+func (f *FailoverRequester) Current() string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if len(f.endpoints) == 0 {
+		return ""
+	}
+	return f.endpoints[f.current].Host
+}
+
+func (f *FailoverRequester) Post(url string, ro *RequestOptions) (*HttpResponse, error) {
+	idempotent := f.options.RetryNonIdempotent || Classify("POST", url) == Validation
+	return f.do(url, ro, idempotent, f.next.Post)
+}
+
+func (f *FailoverRequester) Get(url string, ro *RequestOptions) (*HttpResponse, error) {
+	return f.do(url, ro, true, f.next.Get)
+}
+
+func (f *FailoverRequester) Put(url string, ro *RequestOptions) (*HttpResponse, error) {
+	return f.do(url, ro, true, func(url string, ro *RequestOptions) (*HttpResponse, error) {
+		return Put(f.next, url, ro)
+	})
+}
+
+func (f *FailoverRequester) Delete(url string, ro *RequestOptions) (*HttpResponse, error) {
+	return f.do(url, ro, true, func(url string, ro *RequestOptions) (*HttpResponse, error) {
+		return Delete(f.next, url, ro)
+	})
+}
+
+func (f *FailoverRequester) do(url string, ro *RequestOptions, idempotent bool, send func(string, *RequestOptions) (*HttpResponse, error)) (*HttpResponse, error) {
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") || len(f.endpoints) == 0 {
+		return send(url, ro)
+	}
+
+	var resp *HttpResponse
+	var err error
+	tried := make(map[int]bool, len(f.endpoints))
+	for attempt := 0; attempt < len(f.endpoints); attempt++ {
+		index := f.choose(tried)
+		tried[index] = true
+
+		resp, err = send(strings.TrimSuffix(f.endpoints[index].Host, "/")+url, ro)
+
+		failed, retry := classify(resp, err, idempotent)
+		f.report(index, failed)
+		if !retry || attempt == len(f.endpoints)-1 {
+			break
+		}
+		if resp != nil && resp.Response != nil {
+			resp.Close()
+		}
+	}
+
+	return resp, err
+}
+
+// classify reports whether the response counts as an endpoint failure and
+// whether the request can safely be retried on another endpoint. Requests
+// that are not idempotent are only retried when they were never sent.
+func classify(resp *HttpResponse, err error, idempotent bool) (failed bool, retry bool) {
+	if resp == nil || resp.Response == nil || resp.StatusCode == 0 {
+		return true, idempotent || notSent(err)
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true, idempotent
+	}
+	return resp.StatusCode >= 500, false
+}
+
+// notSent reports whether err happened while connecting, before any byte of
+// the request reached the endpoint.
+func notSent(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	opErr, ok := err.(*net.OpError)
+	return ok && opErr.Op == "dial"
+}
+
+func (f *FailoverRequester) choose(tried map[int]bool) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	now := f.now()
+	if !tried[f.current] && !f.endpoints[f.current].ejectedUntil.After(now) {
+		return f.current
+	}
+
+	next := f.pick(f.current)
+	for i := 0; tried[next] && i < len(f.endpoints); i++ {
+		next = (next + 1) % len(f.endpoints)
+	}
+	if !tried[next] {
+		f.current = next
+	}
+	return next
+}
+
+// pick chooses a healthy endpoint other than skip, falling back to the
+// endpoint following skip when every other endpoint is ejected.
+func (f *FailoverRequester) pick(skip int) int {
+	now := f.now()
+
+	var healthy []int
+	total := 0
+	for i, endpoint := range f.endpoints {
+		if i != skip && !endpoint.ejectedUntil.After(now) {
+			healthy = append(healthy, i)
+			total += endpoint.Weight
+		}
+	}
+
+	if len(healthy) == 0 {
+		return (skip + 1) % len(f.endpoints)
+	}
+	if !f.weighted || total <= 0 {
+		return healthy[0]
+	}
+
+	n := rand.Intn(total)
+	for _, i := range healthy {
+		if n < f.endpoints[i].Weight {
+			return i
+		}
+		n -= f.endpoints[i].Weight
+	}
+	return healthy[len(healthy)-1]
+}
+
+func (f *FailoverRequester) report(index int, failed bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	endpoint := f.endpoints[index]
+	if !failed {
+		endpoint.failures = 0
+		endpoint.ejectedUntil = time.Time{}
+		return
+	}
+
+	endpoint.failures++
+	if endpoint.failures >= f.options.MaxFailures {
+		endpoint.ejectedUntil = f.now().Add(f.options.EjectionTime)
+		if !f.probing && !f.closed {
+			f.probing = true
+			go f.probe()
+		}
+	}
+}
+
+// probe periodically requests the ejected endpoints and restores those that
+// answer, returning once no endpoint is ejected.
+func (f *FailoverRequester) probe() {
+	ticker := time.NewTicker(f.options.ProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+		}
+
+		f.mutex.Lock()
+		now := f.now()
+		var ejected []int
+		for i, endpoint := range f.endpoints {
+			if endpoint.ejectedUntil.After(now) {
+				ejected = append(ejected, i)
+			}
+		}
+		if len(ejected) == 0 {
+			f.probing = false
+			f.mutex.Unlock()
+			return
+		}
+		f.mutex.Unlock()
+
+		for _, i := range ejected {
+			resp, _ := f.next.Get(strings.TrimSuffix(f.endpoints[i].Host, "/")+f.options.ProbePath, &RequestOptions{})
+			if failed, _ := classify(resp, nil, true); !failed {
+				f.report(i, false)
+			}
+			if resp != nil && resp.Response != nil {
+				resp.Close()
+			}
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package globalidentity
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailoverRequester(t *testing.T) {
+	defer leaktest.Check(t)()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", "http://primary/api/test", httpmock.NewStringResponder(http.StatusServiceUnavailable, ""))
+	httpmock.RegisterResponder("POST", "http://secondary/api/test", httpmock.NewStringResponder(http.StatusOK, "{}"))
+
+	requester := NewFailoverRequester(Hosts("http://primary", "http://secondary"), NewRequester(), FailoverOptions{MaxFailures: 1, ProbeInterval: time.Millisecond, RetryNonIdempotent: true})
+	defer requester.Close()
+
+	resp, err := requester.Post("/api/test", &RequestOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "http://secondary", requester.Current())
+
+	resp, err = requester.Post("/api/test", &RequestOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	info := httpmock.GetCallCountInfo()
+	assert.Equal(t, 1, info["POST http://primary/api/test"])
+	assert.Equal(t, 2, info["POST http://secondary/api/test"])
+
+	httpmock.RegisterResponder("GET", "http://primary/", httpmock.NewStringResponder(http.StatusOK, ""))
+	assert.Eventually(t, func() bool {
+		requester.mutex.Lock()
+		defer requester.mutex.Unlock()
+		return !requester.probing
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, "http://secondary", requester.Current())
+}
+
+func TestFailoverRequesterDoesNotRetryServerErrors(t *testing.T) {
+	defer leaktest.Check(t)()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", "http://primary/api/test", httpmock.NewStringResponder(http.StatusInternalServerError, ""))
+	httpmock.RegisterResponder("POST", "http://secondary/api/test", httpmock.NewStringResponder(http.StatusOK, "{}"))
+
+	requester := NewFailoverRequester(Hosts("http://primary", "http://secondary"), NewRequester(), FailoverOptions{MaxFailures: 2})
+	defer requester.Close()
+
+	_, err := requester.Post("/api/test", &RequestOptions{})
+	assert.Equal(t, GlobalIdentityError{"500"}, err)
+	assert.Equal(t, "http://primary", requester.Current())
+
+	_, err = requester.Post("/api/test", &RequestOptions{})
+	assert.NotNil(t, err)
+
+	_, err = requester.Post("/api/test", &RequestOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "http://secondary", requester.Current())
+}
+
+func TestFailoverRequesterNonIdempotent(t *testing.T) {
+	defer leaktest.Check(t)()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	for _, method := range []string{"GET", "POST"} {
+		for _, path := range []string{"/api/test", "/api/authorization/validateToken"} {
+			httpmock.RegisterResponder(method, "http://primary"+path, httpmock.NewStringResponder(http.StatusServiceUnavailable, ""))
+			httpmock.RegisterResponder(method, "http://secondary"+path, httpmock.NewStringResponder(http.StatusOK, "{}"))
+		}
+		httpmock.RegisterResponder(method, "http://down/api/test", func(*http.Request) (*http.Response, error) {
+			return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+		})
+	}
+
+	requester := NewFailoverRequester(Hosts("http://primary", "http://secondary"), NewRequester(), FailoverOptions{MaxFailures: 5})
+	defer requester.Close()
+
+	_, err := requester.Post("/api/test", &RequestOptions{})
+	assert.Equal(t, GlobalIdentityError{"503"}, err)
+
+	_, err = requester.Get("/api/test", &RequestOptions{})
+	assert.Nil(t, err)
+
+	info := httpmock.GetCallCountInfo()
+	assert.Equal(t, 0, info["POST http://secondary/api/test"])
+	assert.Equal(t, 1, info["GET http://secondary/api/test"])
+
+	requester = NewFailoverRequester(Hosts("http://primary", "http://secondary"), NewRequester(), FailoverOptions{MaxFailures: 5})
+	defer requester.Close()
+
+	_, err = requester.Post("/api/authorization/validateToken", &RequestOptions{})
+	assert.Nil(t, err, "validations are safe to repeat")
+
+	requester = NewFailoverRequester(Hosts("http://down", "http://secondary"), NewRequester(), FailoverOptions{MaxFailures: 5})
+	defer requester.Close()
+
+	_, err = requester.Post("/api/test", &RequestOptions{})
+	assert.Nil(t, err, "a request that was never sent is retried")
+}
+
+func TestFailoverRequesterAbsoluteUrl(t *testing.T) {
+	defer leaktest.Check(t)()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", "http://other/api/test", httpmock.NewStringResponder(http.StatusOK, "{}"))
+
+	requester := NewFailoverRequester(Hosts("http://primary"), NewRequester(), FailoverOptions{})
+	defer requester.Close()
+
+	_, err := requester.Get("http://other/api/test", &RequestOptions{})
+	assert.Nil(t, err)
+}
+
+func TestFailoverRequesterWeighted(t *testing.T) {
+	requester := NewFailoverRequester([]Endpoint{{Host: "http://a", Weight: 0}, {Host: "http://b", Weight: 10}}, NewRequester(), FailoverOptions{})
+	defer requester.Close()
+
+	assert.Equal(t, "http://b", requester.Current())
+}
@@ -0,0 +1,67 @@
+package grpcauth
+
+import (
+	"context"
+
+	core "github.com/stone-payments/globalidentity-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// TokenSource provides the authorization sent along with client calls.
+type TokenSource interface {
+	Authorization() (*core.Authorization, error)
+}
+
+type staticTokenSource struct {
+	authorization *core.Authorization
+}
+
+// StaticTokenSource returns a TokenSource that always provides authorization.
+func StaticTokenSource(authorization *core.Authorization) TokenSource {
+	return staticTokenSource{authorization}
+}
+
+func (s staticTokenSource) Authorization() (*core.Authorization, error) {
+	return s.authorization, nil
+}
+
+// UnaryClientInterceptor attaches the token, user key and binding from
+// source to every unary call.
+func UnaryClientInterceptor(source TokenSource) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, err := outgoingContext(ctx, source)
+		if err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor attaches the token, user key and binding from
+// source to every stream.
+func StreamClientInterceptor(source TokenSource) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, err := outgoingContext(ctx, source)
+		if err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+func outgoingContext(ctx context.Context, source TokenSource) (context.Context, error) {
+	authorization, err := source.Authorization()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = metadata.AppendToOutgoingContext(ctx, authorizationMetadata, bearerPrefix+authorization.Token)
+	if authorization.Key != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, userKeyMetadata, authorization.Key)
+	}
+	if authorization.Binding != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, bindingMetadata, authorization.Binding)
+	}
+	return ctx, nil
+}
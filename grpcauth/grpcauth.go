@@ -0,0 +1,10 @@
+// Package grpcauth provides gRPC interceptors that authenticate calls
+// against Global Identity.
+package grpcauth
+
+const (
+	authorizationMetadata = "authorization"
+	userKeyMetadata       = "x-user-key"
+	bindingMetadata       = "x-user-binding"
+	bearerPrefix          = "bearer "
+)
@@ -0,0 +1,104 @@
+package grpcauth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stone-payments/globalidentity-go/authorization"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor validates the token of every unary call and, when
+// methodRoles lists roles for the full method name, requires the user to be
+// in at least one of them. The user key sent along with the token is only
+// trusted when binder verifies its binding; calls carrying a key that is not
+// bound to their token are refused. The authorization is attached to the
+// handler context and can be read with core.FromContext.
+func UnaryServerInterceptor(manager authorization.GlobalIdentityManager, binder *core.Binder, methodRoles map[string][]string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, manager, binder, methodRoles[info.FullMethod])
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of UnaryServerInterceptor.
+func StreamServerInterceptor(manager authorization.GlobalIdentityManager, binder *core.Binder, methodRoles map[string][]string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), manager, binder, methodRoles[info.FullMethod])
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func authenticate(ctx context.Context, manager authorization.GlobalIdentityManager, binder *core.Binder, roles []string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	token := firstValue(md, authorizationMetadata)
+	if len(token) > len(bearerPrefix) && strings.EqualFold(token[:len(bearerPrefix)], bearerPrefix) {
+		token = token[len(bearerPrefix):]
+	}
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "missing token")
+	}
+
+	ok, err := manager.ValidateToken(token)
+	if err != nil && !rejected(err) {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	userKey, binding := firstValue(md, userKeyMetadata), firstValue(md, bindingMetadata)
+	if userKey != "" && !binder.Verify(token, userKey, binding) {
+		return nil, status.Error(codes.PermissionDenied, "user key not bound to token")
+	}
+	if len(roles) > 0 {
+		if userKey == "" {
+			return nil, status.Error(codes.PermissionDenied, "missing user key")
+		}
+
+		ok, err = manager.IsUserInRoles(userKey, roles...)
+		if err != nil && !rejected(err) {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+		if !ok {
+			return nil, status.Error(codes.PermissionDenied, "user not in required roles")
+		}
+	}
+
+	return core.NewContext(ctx, &core.Authorization{Token: token, Key: userKey, Binding: binding}), nil
+}
+
+// rejected reports whether err is an answer of Global Identity refusing the
+// request, rather than a failure to reach it.
+func rejected(err error) bool {
+	giErr, ok := err.(core.GlobalIdentityError)
+	return ok && giErr.StatusCode() < http.StatusInternalServerError
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,115 @@
+package grpcauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stone-payments/globalidentity-go/authorization"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type managerMock struct {
+	authorization.GlobalIdentityManager
+	validToken string
+	roles      map[string][]string
+	err        error
+	rolesErr   error
+}
+
+func (m *managerMock) ValidateToken(token string) (bool, error) {
+	if m.err != nil {
+		return false, m.err
+	}
+	if token != m.validToken {
+		return false, core.GlobalIdentityError([]string{"invalid token"})
+	}
+	return true, nil
+}
+
+func (m *managerMock) IsUserInRoles(userKey string, roles ...string) (bool, error) {
+	if m.rolesErr != nil {
+		return false, m.rolesErr
+	}
+	for _, held := range m.roles[userKey] {
+		for _, role := range roles {
+			if held == role {
+				return true, nil
+			}
+		}
+	}
+	return false, core.GlobalIdentityError([]string{"user not in roles"})
+}
+
+var binder = core.NewBinder([]byte("secret"))
+
+func invoke(manager authorization.GlobalIdentityManager, md metadata.MD) (*core.Authorization, error) {
+	interceptor := UnaryServerInterceptor(manager, binder, map[string][]string{"/svc/Admin": {"ADMIN"}})
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+
+	var authorization *core.Authorization
+	_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/svc/Admin"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		authorization, _ = core.FromContext(ctx)
+		return nil, nil
+	})
+	return authorization, err
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	manager := &managerMock{validToken: "token", roles: map[string][]string{"admin": {"ADMIN"}, "user": {"USER"}}}
+
+	_, err := invoke(manager, metadata.Pairs())
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = invoke(manager, metadata.Pairs("authorization", "bearer wrong", "x-user-key", "admin"))
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = invoke(manager, metadata.Pairs("authorization", "bearer token"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = invoke(manager, metadata.Pairs("authorization", "bearer token", "x-user-key", "user", "x-user-binding", binder.Bind("token", "user")))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	authorization, err := invoke(manager, metadata.Pairs("authorization", "Bearer token", "x-user-key", "admin", "x-user-binding", binder.Bind("token", "admin")))
+	assert.Nil(t, err)
+	assert.Equal(t, &core.Authorization{Token: "token", Key: "admin", Binding: binder.Bind("token", "admin")}, authorization)
+
+	_, err = invoke(manager, metadata.Pairs("authorization", "bearer token", "x-user-key", "admin"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "keys without binding are refused")
+
+	_, err = invoke(manager, metadata.Pairs("authorization", "bearer token", "x-user-key", "admin", "x-user-binding", binder.Bind("token", "user")))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "keys bound to another user are refused")
+
+	_, err = invoke(manager, metadata.Pairs("authorization", "bearer token", "x-user-key", "admin", "x-user-binding", binder.Bind("other-token", "admin")))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "keys bound to another token are refused")
+
+	_, err = invoke(&managerMock{err: errors.New("connection refused")}, metadata.Pairs("authorization", "bearer token"))
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	_, err = invoke(&managerMock{err: core.GlobalIdentityError{"503"}}, metadata.Pairs("authorization", "bearer token"))
+	assert.Equal(t, codes.Unavailable, status.Code(err), "an outage is not a rejection")
+
+	manager.rolesErr = core.GlobalIdentityError{"503"}
+	_, err = invoke(manager, metadata.Pairs("authorization", "Bearer token", "x-user-key", "admin", "x-user-binding", binder.Bind("token", "admin")))
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	interceptor := UnaryClientInterceptor(StaticTokenSource(&core.Authorization{Token: "token", Key: "admin", Binding: "binding"}))
+
+	var md metadata.MD
+	err := interceptor(context.Background(), "/svc/Admin", nil, nil, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"bearer token"}, md.Get("authorization"))
+	assert.Equal(t, []string{"admin"}, md.Get("x-user-key"))
+	assert.Equal(t, []string{"binding"}, md.Get("x-user-binding"))
+}
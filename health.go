@@ -0,0 +1,120 @@
+package globalidentity
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Checks reported in a HealthReport.
+const (
+	CheckReachable      = "reachable"
+	CheckApplicationKey = "application_key"
+	CheckAPIKey         = "api_key"
+)
+
+// HealthCheck is the outcome of one verification made by a health check.
+type HealthCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// HealthReport is the outcome of checking a manager against Global Identity.
+type HealthReport struct {
+	Component string
+	Healthy   bool
+	Latency   time.Duration
+	Checks    []HealthCheck
+}
+
+// NewHealthReport returns a healthy report without checks.
+func NewHealthReport(component string) *HealthReport {
+	return &HealthReport{Component: component, Healthy: true}
+}
+
+// Add records a check, failed when err is not nil.
+func (r *HealthReport) Add(name string, err error) {
+	check := HealthCheck{Name: name, OK: err == nil}
+	if err != nil {
+		check.Error = err.Error()
+		r.Healthy = false
+	}
+	r.Checks = append(r.Checks, check)
+}
+
+// Err returns an error describing the failed checks, or nil if the report
+// is healthy.
+func (r *HealthReport) Err() error {
+	if r.Healthy {
+		return nil
+	}
+	var failed []string
+	for _, check := range r.Checks {
+		if !check.OK {
+			failed = append(failed, r.Component+" "+check.Name+": "+check.Error)
+		}
+	}
+	return HealthError(failed)
+}
+
+func (r *HealthReport) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Component string        `json:"component"`
+		Healthy   bool          `json:"healthy"`
+		LatencyMs float64       `json:"latencyMs"`
+		Checks    []HealthCheck `json:"checks"`
+	}{r.Component, r.Healthy, float64(r.Latency) / float64(time.Millisecond), r.Checks})
+}
+
+// HealthError lists the checks that failed.
+type HealthError []string
+
+func (e HealthError) Error() string {
+	return strings.Join(e, "; ")
+}
+
+// HealthChecker is implemented by the authorization and management managers.
+type HealthChecker interface {
+	Check(ctx context.Context) *HealthReport
+}
+
+// HealthHandler returns a handler, meant for /healthz and /readyz, running
+// every checker concurrently within timeout. It answers 200 when all of them
+// are healthy and 503 otherwise, with the reports as a JSON array.
+func HealthHandler(timeout time.Duration, checkers ...HealthChecker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		reports := make([]*HealthReport, len(checkers))
+		var wg sync.WaitGroup
+		for i, checker := range checkers {
+			wg.Add(1)
+			go func(i int, checker HealthChecker) {
+				defer wg.Done()
+				reports[i] = checker.Check(ctx)
+			}(i, checker)
+		}
+		wg.Wait()
+
+		status := http.StatusOK
+		for _, report := range reports {
+			if !report.Healthy {
+				status = http.StatusServiceUnavailable
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(reports)
+	})
+}
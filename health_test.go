@@ -0,0 +1,50 @@
+package globalidentity
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type checkerMock struct {
+	err error
+}
+
+func (c checkerMock) Check(ctx context.Context) *HealthReport {
+	report := NewHealthReport("mock")
+	report.Add(CheckReachable, c.err)
+	return report
+}
+
+func TestHealthReport(t *testing.T) {
+	report := NewHealthReport("authorization")
+	report.Add(CheckReachable, nil)
+	assert.True(t, report.Healthy)
+	assert.Nil(t, report.Err())
+
+	report.Add(CheckApplicationKey, errors.New("unknown application"))
+	assert.False(t, report.Healthy)
+	assert.Equal(t, HealthError{"authorization application_key: unknown application"}, report.Err())
+}
+
+func TestHealthHandler(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	HealthHandler(0, checkerMock{}).ServeHTTP(recorder, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `[{"component": "mock", "healthy": true, "latencyMs": 0, "checks": [{"name": "reachable", "ok": true}]}]`, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	HealthHandler(0, checkerMock{}, checkerMock{errors.New("connection refused")}).ServeHTTP(recorder, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "connection refused")
+}
+
+func TestGlobalIdentityErrorStatusCode(t *testing.T) {
+	assert.Equal(t, 503, GlobalIdentityError{"503"}.StatusCode())
+	assert.Equal(t, 0, GlobalIdentityError{"user not found"}.StatusCode())
+	assert.Equal(t, 0, GlobalIdentityError{"500", "600"}.StatusCode())
+}
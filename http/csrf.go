@@ -0,0 +1,206 @@
+package http
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrCSRF is the error code of requests refused by the CSRF middleware.
+const ErrCSRF = "csrf_failed"
+
+const (
+	defaultCSRFCookie = "gi_csrf"
+	defaultCSRFHeader = "X-CSRF-Token"
+	defaultCSRFField  = "csrf_token"
+	csrfTokenSize     = 32
+)
+
+// CSRFOptions configures the middleware returned by CSRF.
+type CSRFOptions struct {
+	// Secret, when set, selects synchronizer tokens derived from the session
+	// cookie, so they change with every login. Otherwise a token is kept in a
+	// cookie readable by scripts and must be submitted back (double-submit);
+	// it is a random value signed along with the session cookie by
+	// Config.Binder, so a cookie planted by another site or subdomain is
+	// rejected.
+	Secret []byte
+	// CookieName names the double-submit cookie. It defaults to "gi_csrf".
+	CookieName string
+	// HeaderName and FieldName are where the token is looked for, in that
+	// order. They default to "X-CSRF-Token" and "csrf_token".
+	HeaderName string
+	FieldName  string
+	// TrustedOrigins lists the origins, such as "https://app.example.com",
+	// allowed besides the host of the request.
+	TrustedOrigins []string
+}
+
+// CSRF is middleware protecting cookie-authenticated handlers against
+// cross-site request forgery.
+type CSRF struct {
+	handlers *Handlers
+	options  CSRFOptions
+}
+
+type csrfTokenKey struct{}
+
+// CSRF returns middleware refusing unsafe requests that do not carry a valid
+// token or that come from another origin. Requests with safe methods and
+// requests carrying a bearer token that Config.Manager validates, which
+// browsers never send on their own, are exempt.
+func (h *Handlers) CSRF(options CSRFOptions) *CSRF {
+	if options.CookieName == "" {
+		options.CookieName = defaultCSRFCookie
+	}
+	if options.HeaderName == "" {
+		options.HeaderName = defaultCSRFHeader
+	}
+	if options.FieldName == "" {
+		options.FieldName = defaultCSRFField
+	}
+	return &CSRF{handlers: h, options: options}
+}
+
+// Token returns the token to embed in forms rendered for r, which must have
+// gone through the middleware.
+func Token(r *http.Request) string {
+	token, _ := r.Context().Value(csrfTokenKey{}).(string)
+	return token
+}
+
+// Protect applies the middleware to next.
+func (c *CSRF) Protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expected, fresh := c.token(w, r)
+		if expected != "" {
+			r = r.WithContext(context.WithValue(r.Context(), csrfTokenKey{}, expected))
+		}
+
+		if safeMethod(r.Method) || c.validBearer(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !c.sameOrigin(r) {
+			writeError(w, http.StatusForbidden, ErrCSRF)
+			return
+		}
+		if c.options.Secret != nil && expected == "" {
+			// Without a session there is nothing to forge a request with.
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if fresh {
+			// A token just issued cannot have been submitted yet.
+			writeError(w, http.StatusForbidden, ErrCSRF)
+			return
+		}
+
+		submitted := r.Header.Get(c.options.HeaderName)
+		if submitted == "" {
+			submitted = r.PostFormValue(c.options.FieldName)
+		}
+		if submitted == "" || subtle.ConstantTimeCompare([]byte(submitted), []byte(expected)) != 1 {
+			writeError(w, http.StatusForbidden, ErrCSRF)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// token returns the token expected from r. fresh reports that r had no
+// double-submit cookie signed for its session and that a new one was set.
+func (c *CSRF) token(w http.ResponseWriter, r *http.Request) (token string, fresh bool) {
+	var session string
+	if cookie, err := r.Cookie(c.handlers.config.TokenCookie); err == nil {
+		session = cookie.Value
+	}
+
+	if c.options.Secret != nil {
+		if session == "" {
+			return "", false
+		}
+		mac := hmac.New(sha256.New, c.options.Secret)
+		mac.Write([]byte(session))
+		return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), false
+	}
+
+	if cookie, err := r.Cookie(c.options.CookieName); err == nil {
+		i := strings.LastIndex(cookie.Value, ".")
+		if i > 0 && c.handlers.config.Binder.Verify(session, cookie.Value[:i], cookie.Value[i+1:]) {
+			return cookie.Value, false
+		}
+	}
+	random := make([]byte, csrfTokenSize)
+	if _, err := rand.Read(random); err != nil {
+		return "", true
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(random)
+	token = nonce + "." + c.handlers.config.Binder.Bind(session, nonce)
+	cookie := &http.Cookie{
+		Name:   c.options.CookieName,
+		Value:  token,
+		Path:   c.handlers.config.CookiePath,
+		Domain: c.handlers.config.CookieDomain,
+		Secure: !c.handlers.config.Insecure,
+	}
+	w.Header().Add("Set-Cookie", cookie.String()+"; SameSite=Strict")
+	return token, true
+}
+
+// sameOrigin checks the Origin header or, when absent, the Referer header
+// against the host of r and the trusted origins. Requests carrying neither
+// are left to the token check.
+func (c *CSRF) sameOrigin(r *http.Request) bool {
+	source := r.Header.Get("Origin")
+	if source == "null" {
+		return false
+	}
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return true
+	}
+
+	origin, err := url.Parse(source)
+	if err != nil || origin.Host == "" {
+		return false
+	}
+	if strings.EqualFold(origin.Host, r.Host) {
+		return true
+	}
+	for _, trusted := range c.options.TrustedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(trusted, "/"), origin.Scheme+"://"+origin.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// validBearer reports whether r carries a bearer token that Global Identity
+// accepts. Requests with a token that is refused, or that cannot be checked,
+// go through the CSRF checks like any other.
+func (c *CSRF) validBearer(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	if len(header) <= 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return false
+	}
+	valid, err := c.handlers.config.Manager.ValidateToken(strings.TrimSpace(header[7:]))
+	return valid && err == nil
+}
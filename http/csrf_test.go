@@ -0,0 +1,146 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func csrfRequest(method, body string, headers map[string]string, cookies ...*http.Cookie) *http.Request {
+	req := httptest.NewRequest(method, "http://app.test/form", strings.NewReader(body))
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	return req
+}
+
+func TestCSRFDoubleSubmit(t *testing.T) {
+	h := New(Config{Manager: &managerMock{}})
+	var token string
+	handler := h.CSRF(CSRFOptions{}).Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, csrfRequest("GET", "", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.NotEmpty(t, token)
+	cookie := recorder.Header().Get("Set-Cookie")
+	assert.True(t, strings.HasPrefix(cookie, "gi_csrf="+token+";"))
+	assert.NotContains(t, cookie, "HttpOnly")
+	assert.Contains(t, cookie, "SameSite=Strict")
+
+	csrfCookie := &http.Cookie{Name: "gi_csrf", Value: token}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, csrfRequest("POST", "", map[string]string{"X-CSRF-Token": token}, csrfCookie))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, csrfRequest("POST", "csrf_token="+token, map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, csrfCookie))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, csrfRequest("POST", "", map[string]string{"X-CSRF-Token": "forged"}, csrfCookie))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.JSONEq(t, `{"error": "csrf_failed"}`, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, csrfRequest("POST", "", nil))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, csrfRequest("POST", "", map[string]string{"Authorization": "Bearer token"}))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, csrfRequest("POST", "", map[string]string{"Authorization": "Bearer forged"}))
+	assert.Equal(t, http.StatusForbidden, recorder.Code, "only validated bearer tokens are exempt")
+}
+
+func TestCSRFDoubleSubmitSession(t *testing.T) {
+	h := New(Config{Manager: &managerMock{}})
+	var token string
+	handler := h.CSRF(CSRFOptions{}).Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	}))
+	session := &http.Cookie{Name: "gi_token", Value: "session"}
+
+	handler.ServeHTTP(httptest.NewRecorder(), csrfRequest("GET", "", nil, session))
+	csrfCookie := &http.Cookie{Name: "gi_csrf", Value: token}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, csrfRequest("POST", "", map[string]string{"X-CSRF-Token": token}, session, csrfCookie))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, csrfRequest("POST", "", map[string]string{"X-CSRF-Token": token}, &http.Cookie{Name: "gi_token", Value: "other"}, csrfCookie))
+	assert.Equal(t, http.StatusForbidden, recorder.Code, "a token signed for another session is replaced")
+	assert.Contains(t, recorder.Header().Get("Set-Cookie"), "gi_csrf=")
+
+	planted := &http.Cookie{Name: "gi_csrf", Value: "planted"}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, csrfRequest("POST", "", map[string]string{"X-CSRF-Token": "planted"}, session, planted))
+	assert.Equal(t, http.StatusForbidden, recorder.Code, "an unsigned cookie is rejected")
+}
+
+func TestCSRFOrigin(t *testing.T) {
+	h := New(Config{Manager: &managerMock{}})
+	var token string
+	handler := h.CSRF(CSRFOptions{TrustedOrigins: []string{"https://admin.test"}}).Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), csrfRequest("GET", "", nil))
+	csrfCookie := &http.Cookie{Name: "gi_csrf", Value: token}
+
+	for origin, status := range map[string]int{
+		"http://app.test":    http.StatusOK,
+		"https://admin.test": http.StatusOK,
+		"https://evil.test":  http.StatusForbidden,
+		"null":               http.StatusForbidden,
+	} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, csrfRequest("POST", "", map[string]string{"Origin": origin, "X-CSRF-Token": token}, csrfCookie))
+		assert.Equal(t, status, recorder.Code, origin)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, csrfRequest("POST", "", map[string]string{"Referer": "https://evil.test/page", "X-CSRF-Token": token}, csrfCookie))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, csrfRequest("POST", "", map[string]string{"Referer": "http://app.test/page", "X-CSRF-Token": token}, csrfCookie))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestCSRFSynchronizer(t *testing.T) {
+	h := New(Config{Manager: &managerMock{}})
+	var token string
+	handler := h.CSRF(CSRFOptions{Secret: []byte("secret")}).Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	}))
+	session := &http.Cookie{Name: "gi_token", Value: "session"}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, csrfRequest("GET", "", nil, session))
+	assert.NotEmpty(t, token)
+	assert.Empty(t, recorder.Header().Get("Set-Cookie"))
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, csrfRequest("POST", "", map[string]string{"X-CSRF-Token": token}, session))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, csrfRequest("POST", "", map[string]string{"X-CSRF-Token": token}, &http.Cookie{Name: "gi_token", Value: "other"}))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, csrfRequest("POST", "", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
@@ -0,0 +1,165 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stone-payments/globalidentity-go/authorization"
+	"github.com/stone-payments/globalidentity-go/session"
+)
+
+// Login authenticates the email and password posted as JSON or as a form
+// and sets the session cookies.
+func (h *Handlers) Login() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowPost(w, r) {
+			return
+		}
+		fields, err := readFields(w, r, "email", "password")
+		if err != nil || fields["email"] == "" || fields["password"] == "" {
+			writeError(w, http.StatusBadRequest, ErrInvalidRequest)
+			return
+		}
+
+		authorization, err := h.config.Manager.AuthenticateUser(fields["email"], fields["password"], h.config.Expiration)
+		if err != nil {
+			status, code := failure(err)
+			writeError(w, status, code)
+			return
+		}
+
+		var expires time.Time
+		if h.config.Sessions != nil {
+			created, err := h.config.Sessions.Create(authorization)
+			if err != nil {
+				writeError(w, http.StatusServiceUnavailable, ErrUnavailable)
+				return
+			}
+			h.setSessionID(w, created)
+			expires = created.ExpiresAt
+		} else {
+			minutes := authorization.TokenExpirationInMinutes
+			if minutes <= 0 {
+				minutes = h.config.Expiration
+			}
+			expires = h.setSession(w, authorization, minutes)
+		}
+
+		if h.config.LoginRedirect != "" && !isJSON(r) {
+			http.Redirect(w, r, h.config.LoginRedirect, http.StatusSeeOther)
+			return
+		}
+		writeJSON(w, http.StatusOK, sessionResponse{UserKey: authorization.Key, ExpiresAt: expires})
+	})
+}
+
+// Logout revokes the token of the session, when the server supports it, and
+// clears the session cookies. The cookies are cleared even when Global
+// Identity cannot be reached, in which case 503 is answered.
+func (h *Handlers) Logout() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowPost(w, r) {
+			return
+		}
+		h.clearSession(w)
+
+		if h.config.Sessions != nil {
+			if id, err := r.Cookie(h.config.TokenCookie); err == nil {
+				if err = h.config.Sessions.Revoke(id.Value); err != nil {
+					if status, _ := failure(err); status != http.StatusUnauthorized {
+						writeError(w, status, ErrUnavailable)
+						return
+					}
+				}
+			}
+		} else if current, ok := h.Authorization(r); ok {
+			_, err := authorization.RevokeToken(h.config.Manager, current.Token)
+			if err != nil && err != authorization.ErrUnsupported {
+				if status, _ := failure(err); status != http.StatusUnauthorized {
+					writeError(w, status, ErrUnavailable)
+					return
+				}
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// Renew exchanges the token of the session for a new one and extends the
+// session cookies.
+func (h *Handlers) Renew() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowPost(w, r) {
+			return
+		}
+		if h.config.Sessions != nil {
+			h.renewSession(w, r)
+			return
+		}
+		current, ok := h.Authorization(r)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, ErrUnauthenticated)
+			return
+		}
+
+		token, err := h.config.Manager.RenewToken(current.Token)
+		if err != nil {
+			status, _ := failure(err)
+			if status == http.StatusUnauthorized {
+				h.clearSession(w)
+				writeError(w, status, ErrUnauthenticated)
+				return
+			}
+			writeError(w, status, ErrUnavailable)
+			return
+		}
+
+		renewed := &core.Authorization{Token: token, Key: current.Key}
+		expires := h.setSession(w, renewed, h.config.Expiration)
+		writeJSON(w, http.StatusOK, sessionResponse{UserKey: renewed.Key, ExpiresAt: expires})
+	})
+}
+
+func (h *Handlers) renewSession(w http.ResponseWriter, r *http.Request) {
+	id, err := r.Cookie(h.config.TokenCookie)
+	if err != nil || id.Value == "" {
+		writeError(w, http.StatusUnauthorized, ErrUnauthenticated)
+		return
+	}
+
+	renewed, err := h.config.Sessions.Renew(id.Value)
+	if err == session.ErrNotFound {
+		h.clearSession(w)
+		writeError(w, http.StatusUnauthorized, ErrUnauthenticated)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, ErrUnavailable)
+		return
+	}
+	writeJSON(w, http.StatusOK, sessionResponse{UserKey: renewed.Authorization.Key, ExpiresAt: renewed.ExpiresAt})
+}
+
+// Recover starts the password recovery of the email posted as JSON or as a
+// form. It answers 202 whether or not the account exists.
+func (h *Handlers) Recover() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowPost(w, r) {
+			return
+		}
+		fields, err := readFields(w, r, "email")
+		if err != nil || fields["email"] == "" {
+			writeError(w, http.StatusBadRequest, ErrInvalidRequest)
+			return
+		}
+
+		if _, err = h.config.Manager.RecoverPassword(fields["email"]); err != nil {
+			if status, _ := failure(err); status != http.StatusUnauthorized {
+				writeError(w, status, ErrUnavailable)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
@@ -0,0 +1,298 @@
+// Package http provides net/http handlers logging users in and out of Global
+// Identity with session cookies.
+//
+//	handlers := http.New(http.Config{Manager: manager})
+//	mux.Handle("/auth/", nethttp.StripPrefix("/auth", handlers.Handler()))
+//	mux.Handle("/", handlers.RequireLogin(app))
+package http
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stone-payments/globalidentity-go/authorization"
+	"github.com/stone-payments/globalidentity-go/session"
+)
+
+const (
+	defaultExpiration  = 15
+	defaultTokenCookie = "gi_token"
+	defaultUserCookie  = "gi_user"
+	defaultIDCookie    = "gi_session"
+	maxBodySize        = 1 << 20
+)
+
+// Error codes of the JSON error responses, {"error": code}.
+const (
+	ErrInvalidRequest     = "invalid_request"
+	ErrInvalidCredentials = "invalid_credentials"
+	ErrUnauthenticated    = "unauthenticated"
+	ErrUnavailable        = "unavailable"
+	ErrMethodNotAllowed   = "method_not_allowed"
+)
+
+// Config configures the handlers returned by New.
+type Config struct {
+	// Manager authenticates users and validates their tokens.
+	Manager authorization.GlobalIdentityManager
+	// Expiration is the token lifetime requested at login, in minutes. It
+	// defaults to 15.
+	Expiration int
+	// TokenCookie and UserCookie name the cookies holding the token and the
+	// user key. They default to "gi_token" and "gi_user".
+	TokenCookie string
+	UserCookie  string
+	// Binder binds the user key cookie to the token cookie, so a key edited
+	// by the client is ignored. Processes sharing the cookies must share its
+	// secret. It defaults to a random binder, trusting only the cookies set
+	// by this process.
+	Binder *core.Binder
+	// CookiePath and CookieDomain scope the cookies. CookiePath defaults to
+	// "/".
+	CookiePath   string
+	CookieDomain string
+	// SameSite is the SameSite attribute of the cookies, "Strict" or "Lax".
+	// It defaults to "Lax".
+	SameSite string
+	// Insecure drops the Secure attribute of the cookies, so they are sent
+	// over plain HTTP during development.
+	Insecure bool
+	// Sessions, when set, keeps authorizations on the server. The token
+	// cookie, named "gi_session" by default, then holds an opaque session id
+	// and no user key cookie is set.
+	Sessions *session.Manager
+	// LoginRedirect, when set, is where form logins are redirected to after
+	// succeeding. JSON logins always get a JSON response.
+	LoginRedirect string
+}
+
+// Handlers serves the login, logout, renewal and password recovery
+// endpoints.
+type Handlers struct {
+	config Config
+	now    func() time.Time
+}
+
+// New returns the handlers configured by config.
+func New(config Config) *Handlers {
+	if config.Expiration <= 0 {
+		config.Expiration = defaultExpiration
+	}
+	if config.TokenCookie == "" && config.Sessions != nil {
+		config.TokenCookie = defaultIDCookie
+	}
+	if config.TokenCookie == "" {
+		config.TokenCookie = defaultTokenCookie
+	}
+	if config.UserCookie == "" {
+		config.UserCookie = defaultUserCookie
+	}
+	if config.Binder == nil {
+		binder, err := core.NewRandomBinder()
+		if err != nil {
+			panic("http: " + err.Error())
+		}
+		config.Binder = binder
+	}
+	if config.CookiePath == "" {
+		config.CookiePath = "/"
+	}
+	if config.SameSite == "" {
+		config.SameSite = "Lax"
+	}
+	return &Handlers{config: config, now: time.Now}
+}
+
+// Handler routes /login, /logout, /renew and /recover to their handlers.
+func (h *Handlers) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/login", h.Login())
+	mux.Handle("/logout", h.Logout())
+	mux.Handle("/renew", h.Renew())
+	mux.Handle("/recover", h.Recover())
+	return mux
+}
+
+// Authorization returns the token and user key carried by the cookies of r,
+// or by its session. The token is not validated. The key of a session is
+// bound to its token through Config.Binder. Without sessions, the key is
+// only set when the user cookie binds it to the token that way;
+// since Global Identity does not tell who a token belongs to, the key is not
+// to be trusted before the token itself is validated, as RequireLogin does.
+func (h *Handlers) Authorization(r *http.Request) (*core.Authorization, bool) {
+	token, err := r.Cookie(h.config.TokenCookie)
+	if err != nil || token.Value == "" {
+		return nil, false
+	}
+	if h.config.Sessions != nil {
+		current, err := h.config.Sessions.Get(token.Value)
+		if err != nil {
+			return nil, false
+		}
+		authorization := current.Authorization
+		if authorization.Key != "" {
+			authorization.Binding = h.config.Binder.Bind(authorization.Token, authorization.Key)
+		}
+		return &authorization, true
+	}
+	authorization := &core.Authorization{Token: token.Value}
+	if user, err := r.Cookie(h.config.UserCookie); err == nil {
+		i := strings.LastIndex(user.Value, ".")
+		if i > 0 && h.config.Binder.Verify(token.Value, user.Value[:i], user.Value[i+1:]) {
+			authorization.Key = user.Value[:i]
+			authorization.Binding = user.Value[i+1:]
+		}
+	}
+	return authorization, true
+}
+
+// RequireLogin validates the token of every request before passing it to
+// next, with the authorization stored in its context. Requests without a
+// valid token are answered with 401.
+func (h *Handlers) RequireLogin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization, ok := h.Authorization(r)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, ErrUnauthenticated)
+			return
+		}
+		valid, err := h.config.Manager.ValidateToken(authorization.Token)
+		if err == nil && !valid {
+			writeError(w, http.StatusUnauthorized, ErrUnauthenticated)
+			return
+		}
+		if err != nil {
+			status, _ := failure(err)
+			if status == http.StatusUnauthorized {
+				writeError(w, status, ErrUnauthenticated)
+			} else {
+				writeError(w, status, ErrUnavailable)
+			}
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(core.NewContext(r.Context(), authorization)))
+	})
+}
+
+func (h *Handlers) setSession(w http.ResponseWriter, authorization *core.Authorization, minutes int) time.Time {
+	expires := h.now().Add(time.Duration(minutes) * time.Minute)
+	h.setCookie(w, h.config.TokenCookie, authorization.Token, minutes*60, expires)
+	h.setCookie(w, h.config.UserCookie, h.userCookie(authorization), minutes*60, expires)
+	return expires
+}
+
+// userCookie returns the value of the user key cookie: the key followed by
+// its binding to the token.
+func (h *Handlers) userCookie(authorization *core.Authorization) string {
+	if authorization.Key == "" {
+		return ""
+	}
+	return authorization.Key + "." + h.config.Binder.Bind(authorization.Token, authorization.Key)
+}
+
+// setSessionID sets a cookie without expiry holding the session id, since
+// the session outlives its token when renewed.
+func (h *Handlers) setSessionID(w http.ResponseWriter, current *session.Session) {
+	h.setCookie(w, h.config.TokenCookie, current.ID, 0, time.Time{})
+}
+
+func (h *Handlers) clearSession(w http.ResponseWriter) {
+	h.setCookie(w, h.config.TokenCookie, "", -1, time.Unix(0, 0))
+	if h.config.Sessions == nil {
+		h.setCookie(w, h.config.UserCookie, "", -1, time.Unix(0, 0))
+	}
+}
+
+// setCookie writes the cookie by hand, since http.Cookie only supports
+// SameSite from Go 1.11 on.
+func (h *Handlers) setCookie(w http.ResponseWriter, name, value string, maxAge int, expires time.Time) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     h.config.CookiePath,
+		Domain:   h.config.CookieDomain,
+		Expires:  expires,
+		MaxAge:   maxAge,
+		Secure:   !h.config.Insecure,
+		HttpOnly: true,
+	}
+	if header := cookie.String(); header != "" {
+		w.Header().Add("Set-Cookie", header+"; SameSite="+h.config.SameSite)
+	}
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type sessionResponse struct {
+	UserKey   string    `json:"userKey"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, errorResponse{code})
+}
+
+// failure maps a manager error to a response status. Every answer of Global
+// Identity refusing the request becomes 401, whatever its reason, so
+// responses do not tell whether an account exists.
+func failure(err error) (int, string) {
+	if giErr, ok := err.(core.GlobalIdentityError); ok {
+		status := giErr.StatusCode()
+		if status < 500 && status != http.StatusTooManyRequests {
+			return http.StatusUnauthorized, ErrInvalidCredentials
+		}
+	}
+	return http.StatusServiceUnavailable, ErrUnavailable
+}
+
+func allowPost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+func isJSON(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/json"
+}
+
+// readFields reads the named fields from a JSON object or a form body.
+func readFields(w http.ResponseWriter, r *http.Request, names ...string) (map[string]string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	fields := make(map[string]string, len(names))
+
+	if isJSON(r) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			fields[name], _ = body[name].(string)
+		}
+		return fields, nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		fields[name] = r.PostForm.Get(name)
+	}
+	return fields, nil
+}
@@ -0,0 +1,274 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stone-payments/globalidentity-go/authorization"
+	"github.com/stone-payments/globalidentity-go/session"
+	"github.com/stretchr/testify/assert"
+)
+
+type managerMock struct {
+	authorization.GlobalIdentityManager
+	err     error
+	revoked []string
+}
+
+func (m *managerMock) AuthenticateUser(email string, password string, expirationInMinutes ...int) (*core.Authorization, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	if email != "user@test.com" || password != "secret" {
+		return nil, core.GlobalIdentityError{"invalid password"}
+	}
+	return &core.Authorization{Token: "token", Key: "user", TokenExpirationInMinutes: 30}, nil
+}
+
+func (m *managerMock) ValidateToken(token string) (bool, error) {
+	if m.err != nil {
+		return false, m.err
+	}
+	if token == "expired" {
+		return false, nil
+	}
+	if token != "token" {
+		return false, core.GlobalIdentityError{"invalid token"}
+	}
+	return true, nil
+}
+
+func (m *managerMock) RenewToken(token string) (string, error) {
+	if token != "token" {
+		return "", core.GlobalIdentityError{"invalid token"}
+	}
+	return "renewed", nil
+}
+
+func (m *managerMock) RevokeToken(token string) (bool, error) {
+	m.revoked = append(m.revoked, token)
+	return m.err == nil, m.err
+}
+
+func (m *managerMock) RevokeUserTokens(userKey string) (bool, error) {
+	return false, authorization.ErrUnsupported
+}
+
+func (m *managerMock) RecoverPassword(email string) (bool, error) {
+	if m.err != nil {
+		return false, m.err
+	}
+	if email != "user@test.com" {
+		return false, core.GlobalIdentityError{"user not found"}
+	}
+	return true, nil
+}
+
+var binder = core.NewBinder([]byte("secret"))
+
+func userCookie(token, key string) *http.Cookie {
+	return &http.Cookie{Name: "gi_user", Value: key + "." + binder.Bind(token, key)}
+}
+
+func newHandlers(manager *managerMock) *Handlers {
+	h := New(Config{Manager: manager, LoginRedirect: "/home", Binder: binder})
+	h.now = func() time.Time { return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC) }
+	return h
+}
+
+func serve(handler http.Handler, method, body, contentType string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestLogin(t *testing.T) {
+	h := newHandlers(&managerMock{})
+
+	recorder := serve(h.Login(), "POST", `{"email": "user@test.com", "password": "secret"}`, "application/json")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"userKey": "user", "expiresAt": "2020-01-01T00:30:00Z"}`, recorder.Body.String())
+	cookies := recorder.Header()["Set-Cookie"]
+	if assert.Len(t, cookies, 2) {
+		assert.Equal(t, "gi_token=token; Path=/; Expires=Wed, 01 Jan 2020 00:30:00 GMT; Max-Age=1800; HttpOnly; Secure; SameSite=Lax", cookies[0])
+		assert.True(t, strings.HasPrefix(cookies[1], "gi_user="+userCookie("token", "user").Value+";"))
+	}
+
+	form := url.Values{"email": {"user@test.com"}, "password": {"secret"}}.Encode()
+	recorder = serve(h.Login(), "POST", form, "application/x-www-form-urlencoded")
+	assert.Equal(t, http.StatusSeeOther, recorder.Code)
+	assert.Equal(t, "/home", recorder.Header().Get("Location"))
+	assert.Len(t, recorder.Header()["Set-Cookie"], 2)
+
+	recorder = serve(h.Login(), "POST", `{"email": "user@test.com", "password": "wrong"}`, "application/json")
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.JSONEq(t, `{"error": "invalid_credentials"}`, recorder.Body.String())
+	wrongPassword := recorder.Body.String()
+
+	recorder = serve(h.Login(), "POST", `{"email": "nobody@test.com", "password": "secret"}`, "application/json")
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Equal(t, wrongPassword, recorder.Body.String())
+	assert.Empty(t, recorder.Header()["Set-Cookie"])
+
+	recorder = serve(h.Login(), "POST", `{"email": "user@test.com"}`, "application/json")
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = serve(h.Login(), "GET", "", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	assert.Equal(t, "POST", recorder.Header().Get("Allow"))
+
+	h = newHandlers(&managerMock{err: errors.New("connection refused")})
+	recorder = serve(h.Login(), "POST", `{"email": "user@test.com", "password": "secret"}`, "application/json")
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.JSONEq(t, `{"error": "unavailable"}`, recorder.Body.String())
+}
+
+func TestLogout(t *testing.T) {
+	manager := &managerMock{}
+	h := newHandlers(manager)
+
+	recorder := serve(h.Logout(), "POST", "", "", &http.Cookie{Name: "gi_token", Value: "token"})
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, []string{"token"}, manager.revoked)
+	cookies := recorder.Header()["Set-Cookie"]
+	if assert.Len(t, cookies, 2) {
+		assert.Contains(t, cookies[0], "gi_token=;")
+		assert.Contains(t, cookies[0], "Max-Age=0")
+	}
+
+	manager.err = authorization.ErrUnsupported
+	recorder = serve(h.Logout(), "POST", "", "", &http.Cookie{Name: "gi_token", Value: "token"})
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+
+	manager.err = errors.New("connection refused")
+	recorder = serve(h.Logout(), "POST", "", "", &http.Cookie{Name: "gi_token", Value: "token"})
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Len(t, recorder.Header()["Set-Cookie"], 2)
+}
+
+func TestRenew(t *testing.T) {
+	h := newHandlers(&managerMock{})
+
+	recorder := serve(h.Renew(), "POST", "", "", &http.Cookie{Name: "gi_token", Value: "token"}, userCookie("token", "user"))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"userKey": "user", "expiresAt": "2020-01-01T00:15:00Z"}`, recorder.Body.String())
+	assert.True(t, strings.HasPrefix(recorder.Header()["Set-Cookie"][0], "gi_token=renewed;"))
+	assert.True(t, strings.HasPrefix(recorder.Header()["Set-Cookie"][1], "gi_user="+userCookie("renewed", "user").Value+";"))
+
+	recorder = serve(h.Renew(), "POST", "", "", &http.Cookie{Name: "gi_token", Value: "expired"})
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Contains(t, recorder.Header()["Set-Cookie"][0], "Max-Age=0")
+
+	recorder = serve(h.Renew(), "POST", "", "")
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.JSONEq(t, `{"error": "unauthenticated"}`, recorder.Body.String())
+}
+
+func TestRecover(t *testing.T) {
+	h := newHandlers(&managerMock{})
+
+	recorder := serve(h.Recover(), "POST", `{"email": "user@test.com"}`, "application/json")
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+
+	unknown := serve(h.Recover(), "POST", "email=nobody%40test.com", "application/x-www-form-urlencoded")
+	assert.Equal(t, recorder.Code, unknown.Code)
+	assert.Equal(t, recorder.Body.String(), unknown.Body.String())
+
+	recorder = serve(h.Recover(), "POST", `{}`, "application/json")
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	h = newHandlers(&managerMock{err: core.GlobalIdentityError{"502"}})
+	recorder = serve(h.Recover(), "POST", `{"email": "user@test.com"}`, "application/json")
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+}
+
+func TestRequireLogin(t *testing.T) {
+	h := newHandlers(&managerMock{})
+
+	var got *core.Authorization
+	handler := h.RequireLogin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = core.FromContext(r.Context())
+	}))
+
+	recorder := serve(handler, "GET", "", "", &http.Cookie{Name: "gi_token", Value: "token"}, userCookie("token", "user"))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, &core.Authorization{Token: "token", Key: "user", Binding: binder.Bind("token", "user")}, got)
+
+	for _, forged := range []*http.Cookie{
+		{Name: "gi_user", Value: "admin"},
+		{Name: "gi_user", Value: "admin." + binder.Bind("token", "user")},
+		userCookie("other-token", "admin"),
+	} {
+		recorder = serve(handler, "GET", "", "", &http.Cookie{Name: "gi_token", Value: "token"}, forged)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, &core.Authorization{Token: "token"}, got, "an unbound user key is ignored")
+	}
+
+	recorder = serve(handler, "GET", "", "", &http.Cookie{Name: "gi_token", Value: "wrong"})
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	got = nil
+	recorder = serve(handler, "GET", "", "", &http.Cookie{Name: "gi_token", Value: "expired"}, userCookie("expired", "user"))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Nil(t, got, "a token reported invalid without error is rejected")
+
+	recorder = serve(handler, "GET", "", "")
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestHandler(t *testing.T) {
+	h := newHandlers(&managerMock{})
+	recorder := httptest.NewRecorder()
+	h.Handler().ServeHTTP(recorder, httptest.NewRequest("POST", "/recover", strings.NewReader(`{"email": "user@test.com"}`)))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestSessions(t *testing.T) {
+	manager := &managerMock{}
+	sessions := session.NewManager(session.NewMemoryStore(), manager, session.Options{})
+	h := New(Config{Manager: manager, Sessions: sessions})
+
+	recorder := serve(h.Login(), "POST", `{"email": "user@test.com", "password": "secret"}`, "application/json")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	cookies := recorder.Header()["Set-Cookie"]
+	if !assert.Len(t, cookies, 1) {
+		return
+	}
+	assert.NotContains(t, cookies[0], "token")
+	assert.NotContains(t, cookies[0], "Expires")
+	id := strings.TrimPrefix(strings.Split(cookies[0], ";")[0], "gi_session=")
+
+	var got *core.Authorization
+	handler := h.RequireLogin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = core.FromContext(r.Context())
+	}))
+	recorder = serve(handler, "GET", "", "", &http.Cookie{Name: "gi_session", Value: id})
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "token", got.Token)
+	assert.Equal(t, "user", got.Key)
+
+	recorder = serve(handler, "GET", "", "", &http.Cookie{Name: "gi_session", Value: "token"})
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	recorder = serve(h.Renew(), "POST", "", "", &http.Cookie{Name: "gi_session", Value: id})
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	current, _ := sessions.Get(id)
+	assert.Equal(t, "renewed", current.Authorization.Token)
+
+	recorder = serve(h.Logout(), "POST", "", "", &http.Cookie{Name: "gi_session", Value: id})
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, []string{"renewed"}, manager.revoked)
+	_, err := sessions.Get(id)
+	assert.Equal(t, session.ErrNotFound, err)
+}
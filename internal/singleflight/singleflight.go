@@ -0,0 +1,53 @@
+// Package singleflight coalesces concurrent identical calls into one.
+package singleflight
+
+import "sync"
+
+type call struct {
+	done    chan struct{}
+	value   interface{}
+	err     error
+	waiters int
+}
+
+// Group runs at most one call per key at a time. A nil Group runs every
+// call on its own.
+type Group struct {
+	mutex sync.Mutex
+	calls map[string]*call
+}
+
+// Do runs fn unless a call with the same key is already in flight, in which
+// case it waits for that call and returns its result. shared reports
+// whether the result was given to more than one caller.
+func (g *Group) Do(key string, fn func() (interface{}, error)) (value interface{}, err error, shared bool) {
+	if g == nil {
+		value, err = fn()
+		return value, err, false
+	}
+
+	g.mutex.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	if c, found := g.calls[key]; found {
+		c.waiters++
+		g.mutex.Unlock()
+		<-c.done
+		return c.value, c.err, true
+	}
+	c := &call{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mutex.Unlock()
+
+	defer func() {
+		g.mutex.Lock()
+		delete(g.calls, key)
+		shared = c.waiters > 0
+		g.mutex.Unlock()
+		close(c.done)
+	}()
+
+	c.value, c.err = fn()
+	return c.value, c.err, false
+}
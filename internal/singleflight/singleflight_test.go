@@ -0,0 +1,72 @@
+package singleflight
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDo(t *testing.T) {
+	var group Group
+	var calls int32
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	fn := func() (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return "value", errors.New("failed")
+	}
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, 5)
+	shared := make([]bool, 5)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0], _, shared[0] = group.Do("key", fn)
+	}()
+	<-started
+	for i := 1; i < len(results); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _, shared[i] = group.Do("key", fn)
+		}(i)
+	}
+	for {
+		runtime.Gosched()
+		group.mutex.Lock()
+		waiters := group.calls["key"].waiters
+		group.mutex.Unlock()
+		if waiters == len(results)-1 {
+			break
+		}
+	}
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls)
+	for i := range results {
+		assert.Equal(t, "value", results[i])
+		assert.True(t, shared[i])
+	}
+
+	_, err, isShared := group.Do("key", func() (interface{}, error) { return nil, nil })
+	assert.Nil(t, err)
+	assert.False(t, isShared)
+}
+
+func TestNilGroup(t *testing.T) {
+	var group *Group
+	value, err, shared := group.Do("key", func() (interface{}, error) { return 1, nil })
+	assert.Equal(t, 1, value)
+	assert.Nil(t, err)
+	assert.False(t, shared)
+}
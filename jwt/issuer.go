@@ -0,0 +1,169 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stone-payments/globalidentity-go/authorization"
+	"github.com/stone-payments/globalidentity-go/management"
+)
+
+const defaultTTL = 5 * time.Minute
+
+// ErrInvalidToken is returned by Issue when Global Identity does not
+// consider the token valid.
+var ErrInvalidToken = errors.New("jwt: invalid Global Identity token")
+
+// ErrInactiveUser is returned by Issue when the user is inactive or locked
+// out.
+var ErrInactiveUser = errors.New("jwt: inactive or locked out user")
+
+// IssuerOptions configures an Issuer.
+type IssuerOptions struct {
+	// Issuer and Audience fill the "iss" and "aud" claims.
+	Issuer   string
+	Audience []string
+	// TTL is the lifetime of the tokens. It defaults to 5 minutes.
+	TTL time.Duration
+	// Binder checks the user key of the authorizations given to Handler is
+	// bound to their token. It must be the binder of the http handlers
+	// setting them; without it Handler refuses every request.
+	Binder *core.Binder
+}
+
+// Issuer exchanges Global Identity tokens for signed JWTs carrying the user
+// key, name and active roles of the user.
+type Issuer struct {
+	keyring       *Keyring
+	authorization authorization.GlobalIdentityManager
+	management    management.GlobalIdentityManager
+	options       IssuerOptions
+	now           func() time.Time
+}
+
+// NewIssuer returns an issuer validating tokens with authorizationManager,
+// looking users up with managementManager and signing with keyring.
+func NewIssuer(keyring *Keyring, authorizationManager authorization.GlobalIdentityManager, managementManager management.GlobalIdentityManager, options IssuerOptions) *Issuer {
+	if options.TTL <= 0 {
+		options.TTL = defaultTTL
+	}
+	return &Issuer{
+		keyring:       keyring,
+		authorization: authorizationManager,
+		management:    managementManager,
+		options:       options,
+		now:           time.Now,
+	}
+}
+
+// Issue validates token once and returns a JWT for the user with the email,
+// along with its claims. Inactive and locked out users get no JWT. The
+// pairing of token and user is trusted, so it must come from a server-side
+// source such as a session.
+func (i *Issuer) Issue(token, email string) (string, *Claims, error) {
+	valid, err := i.authorization.ValidateToken(token)
+	if err != nil {
+		return "", nil, err
+	}
+	if !valid {
+		return "", nil, ErrInvalidToken
+	}
+
+	user, err := i.management.User(email, true)
+	if err != nil {
+		return "", nil, err
+	}
+	if !user.Active || user.LockedOut {
+		return "", nil, ErrInactiveUser
+	}
+
+	id := make([]byte, 16)
+	if _, err = rand.Read(id); err != nil {
+		return "", nil, err
+	}
+
+	now := i.now()
+	claims := &Claims{
+		Issuer:    i.options.Issuer,
+		Subject:   user.UserKey,
+		Audience:  Audience(i.options.Audience),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(i.options.TTL).Unix(),
+		ID:        hex.EncodeToString(id),
+		Name:      user.Name,
+		Roles:     user.Roles,
+	}
+
+	signed, err := i.keyring.Sign(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+type issueResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Handler answers POST requests with a JWT for the authorization in their
+// context, so it must be mounted behind middleware setting it, such as
+// RequireLogin of the http package. The user key of the authorization is
+// only trusted when IssuerOptions.Binder binds it to the token, and is then
+// resolved to an email with users. It answers 401 when the key is not bound,
+// the token is no longer valid or the user is unknown, inactive or locked out
+// and 503 when Global Identity cannot be reached.
+func (i *Issuer) Handler(users *management.Directory) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "method_not_allowed")
+			return
+		}
+		current, ok := core.FromContext(r.Context())
+		if !ok || !i.options.Binder.Verify(current.Token, current.Key, current.Binding) {
+			writeError(w, http.StatusUnauthorized, "unauthenticated")
+			return
+		}
+		user, ok := users.ByKey(current.Key)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "unauthenticated")
+			return
+		}
+
+		token, claims, err := i.Issue(current.Token, user.Email)
+		if err != nil {
+			if unauthorized(err) {
+				writeError(w, http.StatusUnauthorized, "unauthenticated")
+				return
+			}
+			writeError(w, http.StatusServiceUnavailable, "unavailable")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(issueResponse{Token: token, ExpiresAt: time.Unix(claims.ExpiresAt, 0).UTC()})
+	})
+}
+
+func unauthorized(err error) bool {
+	if err == ErrInvalidToken || err == ErrInactiveUser {
+		return true
+	}
+	if giErr, ok := err.(core.GlobalIdentityError); ok {
+		return giErr.StatusCode() < http.StatusInternalServerError
+	}
+	return false
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
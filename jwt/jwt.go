@@ -0,0 +1,182 @@
+// Package jwt mints short-lived signed JWTs for users authenticated by
+// Global Identity, so internal services can verify them offline with the
+// verifier package instead of calling ValidateToken.
+package jwt
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// Signing algorithms.
+const (
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+var (
+	// ErrMalformed is returned for tokens that are not a signed JWT.
+	ErrMalformed = errors.New("jwt: malformed token")
+	// ErrAlgorithm is returned for algorithms other than RS256 and EdDSA, or
+	// that do not match the key.
+	ErrAlgorithm = errors.New("jwt: unsupported algorithm")
+	// ErrSignature is returned when the signature does not match the key.
+	ErrSignature = errors.New("jwt: invalid signature")
+)
+
+// Header is the JOSE header of a token.
+type Header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+}
+
+// Claims are the claims of the tokens minted by an Issuer. Times are unix
+// seconds.
+type Claims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat"`
+	ID        string   `json:"jti,omitempty"`
+	Name      string   `json:"name,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+}
+
+// HasRole reports whether role is among the roles of the claims.
+func (c *Claims) HasRole(role string) bool {
+	for _, held := range c.Roles {
+		if held == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Audience is the "aud" claim, encoded as a string when it holds a single
+// audience.
+type Audience []string
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = Audience(multiple)
+	return nil
+}
+
+// Contains reports whether audience is one of the audiences.
+func (a Audience) Contains(audience string) bool {
+	for _, value := range a {
+		if value == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the claims signed with key.
+func Sign(key *Key, claims *Claims) (string, error) {
+	header, err := json.Marshal(Header{Algorithm: key.Algorithm, Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	input := encode(header) + "." + encode(payload)
+	signature, err := key.sign([]byte(input))
+	if err != nil {
+		return "", err
+	}
+	return input + "." + encode(signature), nil
+}
+
+// Token is a parsed token whose signature has not been verified yet.
+type Token struct {
+	Header    Header
+	Claims    Claims
+	input     []byte
+	signature []byte
+}
+
+// Parse decodes a token without verifying it.
+func Parse(token string) (*Token, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	parsed := &Token{input: []byte(parts[0] + "." + parts[1])}
+	header, err := decode(parts[0])
+	if err != nil || json.Unmarshal(header, &parsed.Header) != nil {
+		return nil, ErrMalformed
+	}
+	payload, err := decode(parts[1])
+	if err != nil || json.Unmarshal(payload, &parsed.Claims) != nil {
+		return nil, ErrMalformed
+	}
+	if parsed.signature, err = decode(parts[2]); err != nil {
+		return nil, ErrMalformed
+	}
+	return parsed, nil
+}
+
+// Verify checks the signature of the token against key. The algorithm of
+// the header must be the one of key, so a token cannot choose how it is
+// verified.
+func (t *Token) Verify(key crypto.PublicKey) error {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if t.Header.Algorithm != RS256 {
+			return ErrAlgorithm
+		}
+		digest := sha256.Sum256(t.input)
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], t.signature) != nil {
+			return ErrSignature
+		}
+		return nil
+	case ed25519.PublicKey:
+		if t.Header.Algorithm != EdDSA {
+			return ErrAlgorithm
+		}
+		if len(key) != ed25519.PublicKeySize || !ed25519.Verify(key, t.input, t.signature) {
+			return ErrSignature
+		}
+		return nil
+	default:
+		return ErrAlgorithm
+	}
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decode(data string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(data)
+}
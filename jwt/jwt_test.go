@@ -0,0 +1,287 @@
+package jwt
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stone-payments/globalidentity-go/authorization"
+	gihttp "github.com/stone-payments/globalidentity-go/http"
+	"github.com/stone-payments/globalidentity-go/management"
+	"github.com/stone-payments/globalidentity-go/management/managementtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func generate(t *testing.T, algorithm string) *Key {
+	key, err := GenerateKey(algorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestSignAndVerify(t *testing.T) {
+	for _, algorithm := range []string{RS256, EdDSA} {
+		key := generate(t, algorithm)
+		claims := &Claims{Subject: "user", Audience: Audience{"orders"}, ExpiresAt: 10, Roles: []string{"admin"}}
+
+		signed, err := Sign(key, claims)
+		assert.Nil(t, err, algorithm)
+
+		parsed, err := Parse(signed)
+		assert.Nil(t, err, algorithm)
+		assert.Equal(t, algorithm, parsed.Header.Algorithm)
+		assert.Equal(t, key.ID, parsed.Header.KeyID)
+		assert.Equal(t, *claims, parsed.Claims)
+		assert.Nil(t, parsed.Verify(key.Public()), algorithm)
+
+		public, err := key.JWK().PublicKey()
+		assert.Nil(t, err, algorithm)
+		assert.Nil(t, parsed.Verify(public), algorithm)
+	}
+}
+
+func TestVerifyRejectsTamperedTokens(t *testing.T) {
+	key := generate(t, EdDSA)
+	signed, _ := Sign(key, &Claims{Subject: "user"})
+	parts := strings.Split(signed, ".")
+
+	forged, _ := json.Marshal(Claims{Subject: "admin"})
+	parsed, err := Parse(parts[0] + "." + encode(forged) + "." + parts[2])
+	assert.Nil(t, err)
+	assert.Equal(t, ErrSignature, parsed.Verify(key.Public()))
+
+	parsed, _ = Parse(signed)
+	assert.Equal(t, ErrSignature, parsed.Verify(generate(t, EdDSA).Public()))
+}
+
+func TestVerifyRejectsMismatchedAlgorithm(t *testing.T) {
+	signed, _ := Sign(generate(t, EdDSA), &Claims{Subject: "user"})
+	parsed, _ := Parse(signed)
+	assert.Equal(t, ErrAlgorithm, parsed.Verify(generate(t, RS256).Public()))
+
+	header, _ := json.Marshal(Header{Algorithm: "none"})
+	parts := strings.Split(signed, ".")
+	parsed, _ = Parse(encode(header) + "." + parts[1] + ".")
+	assert.Equal(t, ErrAlgorithm, parsed.Verify(generate(t, RS256).Public()))
+}
+
+func TestParseMalformed(t *testing.T) {
+	for _, token := range []string{"", "a.b", "a.b.c", "e30.e30.!"} {
+		_, err := Parse(token)
+		assert.Equal(t, ErrMalformed, err, token)
+	}
+}
+
+func TestAudienceJSON(t *testing.T) {
+	data, _ := json.Marshal(Audience{"orders"})
+	assert.Equal(t, `"orders"`, string(data))
+	data, _ = json.Marshal(Audience{"orders", "payments"})
+	assert.Equal(t, `["orders","payments"]`, string(data))
+
+	var audience Audience
+	assert.Nil(t, json.Unmarshal([]byte(`"orders"`), &audience))
+	assert.Equal(t, Audience{"orders"}, audience)
+	assert.Nil(t, json.Unmarshal([]byte(`["orders","payments"]`), &audience))
+	assert.True(t, audience.Contains("payments"))
+	assert.NotNil(t, json.Unmarshal([]byte(`1`), &audience))
+}
+
+func TestKeyringRotation(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	first, second, third := generate(t, EdDSA), generate(t, EdDSA), generate(t, RS256)
+	keyring := NewKeyring(first, time.Hour)
+	keyring.now = func() time.Time { return now }
+
+	keyring.Rotate(second)
+	assert.Equal(t, second, keyring.Current())
+	ids := func() []string {
+		var ids []string
+		for _, key := range keyring.JWKS().Keys {
+			ids = append(ids, key.KeyID)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{second.ID, first.ID}, ids())
+
+	now = now.Add(40 * time.Minute)
+	keyring.Rotate(third)
+	assert.Equal(t, []string{third.ID, second.ID, first.ID}, ids())
+
+	now = now.Add(30 * time.Minute)
+	assert.Equal(t, []string{third.ID, second.ID}, ids())
+
+	signed, _ := keyring.Sign(&Claims{Subject: "user"})
+	parsed, _ := Parse(signed)
+	assert.Equal(t, third.ID, parsed.Header.KeyID)
+}
+
+func TestKeyringHandler(t *testing.T) {
+	keyring := NewKeyring(generate(t, RS256), time.Hour)
+
+	recorder := httptest.NewRecorder()
+	keyring.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+	var jwks JWKS
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &jwks))
+	assert.Equal(t, keyring.JWKS(), jwks)
+
+	recorder = httptest.NewRecorder()
+	keyring.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+type authorizationMock struct {
+	authorization.GlobalIdentityManager
+	err   error
+	calls int
+}
+
+func (m *authorizationMock) ValidateToken(token string) (bool, error) {
+	m.calls++
+	if m.err != nil {
+		return false, m.err
+	}
+	if token != "token" {
+		return false, core.GlobalIdentityError{"invalid token"}
+	}
+	return true, nil
+}
+
+var binder = core.NewBinder([]byte("secret"))
+
+// bound returns the authorization of token and key, bound by binder.
+func bound(token, key string) *core.Authorization {
+	return &core.Authorization{Token: token, Key: key, Binding: binder.Bind(token, key)}
+}
+
+func newIssuer(t *testing.T) (*Issuer, *authorizationMock, *managementtest.Manager) {
+	validator := &authorizationMock{}
+	users := managementtest.New(
+		core.User{UserKey: "key", Email: "user@test.com", Name: "User", Active: true, Roles: []string{"admin", "viewer"}},
+		core.User{UserKey: "other", Email: "other@test.com", Name: "Other", Active: true, Roles: []string{"admin"}},
+	)
+	issuer := NewIssuer(NewKeyring(generate(t, EdDSA), time.Hour), validator, users, IssuerOptions{Issuer: "edge", Audience: []string{"orders"}, Binder: binder})
+	issuer.now = func() time.Time { return time.Unix(1000, 0) }
+	return issuer, validator, users
+}
+
+func TestIssue(t *testing.T) {
+	issuer, validator, users := newIssuer(t)
+
+	signed, claims, err := issuer.Issue("token", "user@test.com")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, validator.calls)
+	assert.Equal(t, 1, users.Calls("User"))
+	assert.Equal(t, 0, users.Calls("UserRoles"), "roles come with the user")
+	assert.Equal(t, "key", claims.Subject)
+	assert.Equal(t, "User", claims.Name)
+	assert.Equal(t, "edge", claims.Issuer)
+	assert.Equal(t, Audience{"orders"}, claims.Audience)
+	assert.Equal(t, []string{"admin", "viewer"}, claims.Roles)
+	assert.Equal(t, int64(1000), claims.IssuedAt)
+	assert.Equal(t, int64(1300), claims.ExpiresAt)
+	assert.NotEmpty(t, claims.ID)
+
+	parsed, _ := Parse(signed)
+	assert.Nil(t, parsed.Verify(issuer.keyring.Current().Public()))
+	assert.Equal(t, *claims, parsed.Claims)
+}
+
+func TestIssueFailures(t *testing.T) {
+	issuer, validator, users := newIssuer(t)
+
+	_, _, err := issuer.Issue("other", "user@test.com")
+	assert.Equal(t, core.GlobalIdentityError{"invalid token"}, err)
+
+	_, _, err = issuer.Issue("token", "unknown@test.com")
+	assert.NotNil(t, err)
+
+	users.Put(core.User{UserKey: "key", Email: "user@test.com", Active: false})
+	_, _, err = issuer.Issue("token", "user@test.com")
+	assert.Equal(t, ErrInactiveUser, err)
+
+	users.Put(core.User{UserKey: "key", Email: "user@test.com", Active: true, LockedOut: true})
+	_, _, err = issuer.Issue("token", "user@test.com")
+	assert.Equal(t, ErrInactiveUser, err)
+
+	failure := errors.New("unavailable")
+	users.Fail("User", failure)
+	_, _, err = issuer.Issue("token", "user@test.com")
+	assert.Equal(t, failure, err)
+
+	validator.err = failure
+	_, _, err = issuer.Issue("token", "user@test.com")
+	assert.Equal(t, failure, err)
+}
+
+func TestIssuerHandler(t *testing.T) {
+	issuer, validator, users := newIssuer(t)
+	directory := management.NewDirectory(users, time.Hour, false)
+	assert.Nil(t, directory.Refresh())
+	handler := issuer.Handler(directory)
+
+	serve := func(method string, authorization *core.Authorization) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/token", nil)
+		if authorization != nil {
+			req = req.WithContext(core.NewContext(req.Context(), authorization))
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := serve(http.MethodPost, bound("token", "key"))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "no-store", recorder.Header().Get("Cache-Control"))
+	var response issueResponse
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, time.Unix(1300, 0).UTC(), response.ExpiresAt)
+	parsed, err := Parse(response.Token)
+	assert.Nil(t, err)
+	assert.Equal(t, "key", parsed.Claims.Subject)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodGet, nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodPost, nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodPost, bound("token", "unknown")).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodPost, bound("expired", "key")).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodPost, &core.Authorization{Token: "token", Key: "key"}).Code, "unbound key")
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodPost, &core.Authorization{Token: "token", Key: "other", Binding: binder.Bind("stolen", "other")}).Code, "key bound to another token")
+
+	users.Put(core.User{UserKey: "key", Email: "user@test.com", Active: true, LockedOut: true})
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodPost, bound("token", "key")).Code, "locked out user")
+
+	validator.err = core.GlobalIdentityError{"503"}
+	assert.Equal(t, http.StatusServiceUnavailable, serve(http.MethodPost, bound("token", "key")).Code)
+}
+
+func TestIssuerHandlerForeignUserCookie(t *testing.T) {
+	issuer, _, users := newIssuer(t)
+	directory := management.NewDirectory(users, time.Hour, false)
+	assert.Nil(t, directory.Refresh())
+	handlers := gihttp.New(gihttp.Config{Manager: &authorizationMock{}, Binder: binder})
+	handler := handlers.RequireLogin(issuer.Handler(directory))
+
+	serve := func(user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/token", nil)
+		req.AddCookie(&http.Cookie{Name: "gi_token", Value: "token"})
+		req.AddCookie(&http.Cookie{Name: "gi_user", Value: user})
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := serve("key." + binder.Bind("token", "key"))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	for _, user := range []string{"other", "other." + binder.Bind("token", "key"), "other." + binder.Bind("stolen", "other")} {
+		assert.Equal(t, http.StatusUnauthorized, serve(user).Code, user)
+	}
+}
@@ -0,0 +1,126 @@
+package jwt
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type retiredKey struct {
+	jwk   JWK
+	until time.Time
+}
+
+// Keyring holds the key tokens are signed with and the public keys it
+// replaced, which are still published until the tokens they signed have
+// expired.
+type Keyring struct {
+	retention time.Duration
+	now       func() time.Time
+
+	mutex   sync.RWMutex
+	current *Key
+	retired []retiredKey
+}
+
+// NewKeyring returns a keyring signing with key. Keys replaced by Rotate are
+// published for retention, which must be longer than the lifetime of the
+// tokens plus the time verifiers cache key sets.
+func NewKeyring(key *Key, retention time.Duration) *Keyring {
+	return &Keyring{retention: retention, now: time.Now, current: key}
+}
+
+// Current returns the key tokens are signed with.
+func (k *Keyring) Current() *Key {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	return k.current
+}
+
+// Rotate makes next the signing key, retiring the current one.
+func (k *Keyring) Rotate(next *Key) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	now := k.now()
+	retired := []retiredKey{{jwk: k.current.JWK(), until: now.Add(k.retention)}}
+	for _, key := range k.retired {
+		if key.until.After(now) {
+			retired = append(retired, key)
+		}
+	}
+	k.retired = retired
+	k.current = next
+}
+
+// RotateEvery generates a new key for algorithm and rotates to it every
+// interval until stop is called. Generation errors are passed to onError,
+// which may be nil, and the current key is kept.
+func (k *Keyring) RotateEvery(interval time.Duration, algorithm string, onError func(error)) (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			key, err := GenerateKey(algorithm)
+			if err != nil {
+				if onError != nil {
+					onError(err)
+				}
+				continue
+			}
+			k.Rotate(key)
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-finished
+		})
+	}
+}
+
+// Sign signs the claims with the current key.
+func (k *Keyring) Sign(claims *Claims) (string, error) {
+	return Sign(k.Current(), claims)
+}
+
+// JWKS returns the current key and the retired keys still published.
+func (k *Keyring) JWKS() JWKS {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	now := k.now()
+	keys := []JWK{k.current.JWK()}
+	for _, key := range k.retired {
+		if key.until.After(now) {
+			keys = append(keys, key.jwk)
+		}
+	}
+	return JWKS{Keys: keys}
+}
+
+// Handler serves the key set, to be mounted on a path such as
+// /.well-known/jwks.json.
+func (k *Keyring) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(k.JWKS())
+	})
+}
@@ -0,0 +1,170 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+const minRSABits = 2048
+
+// Key is a private key tokens are signed with.
+type Key struct {
+	ID        string
+	Algorithm string
+	signer    crypto.Signer
+}
+
+// NewKey returns a key signing with RS256 for RSA keys of at least 2048
+// bits and with EdDSA for Ed25519 keys.
+func NewKey(id string, private crypto.Signer) (*Key, error) {
+	switch private := private.(type) {
+	case *rsa.PrivateKey:
+		if private.N.BitLen() < minRSABits {
+			return nil, errors.New("jwt: RSA keys must have at least 2048 bits")
+		}
+		return &Key{ID: id, Algorithm: RS256, signer: private}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: id, Algorithm: EdDSA, signer: private}, nil
+	default:
+		return nil, ErrAlgorithm
+	}
+}
+
+// GenerateKey returns a new key for algorithm with a random id.
+func GenerateKey(algorithm string) (*Key, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	switch algorithm {
+	case RS256:
+		private, err := rsa.GenerateKey(rand.Reader, minRSABits)
+		if err != nil {
+			return nil, err
+		}
+		return NewKey(hex.EncodeToString(id), private)
+	case EdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return NewKey(hex.EncodeToString(id), private)
+	default:
+		return nil, ErrAlgorithm
+	}
+}
+
+// Public returns the public key tokens signed with k are verified with.
+func (k *Key) Public() crypto.PublicKey {
+	return k.signer.Public()
+}
+
+// JWK returns the public key of k as a JSON Web Key.
+func (k *Key) JWK() JWK {
+	jwk, _ := NewJWK(k.ID, k.Public())
+	return jwk
+}
+
+func (k *Key) sign(input []byte) ([]byte, error) {
+	if k.Algorithm == RS256 {
+		digest := sha256.Sum256(input)
+		return k.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	return k.signer.Sign(rand.Reader, input, crypto.Hash(0))
+}
+
+// JWK is a public JSON Web Key.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// NewJWK returns the JSON Web Key of an RSA or Ed25519 public key.
+func NewJWK(id string, public crypto.PublicKey) (JWK, error) {
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType:   "RSA",
+			Use:       "sig",
+			Algorithm: RS256,
+			KeyID:     id,
+			N:         encode(public.N.Bytes()),
+			E:         encode(big.NewInt(int64(public.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType:   "OKP",
+			Use:       "sig",
+			Algorithm: EdDSA,
+			KeyID:     id,
+			Curve:     "Ed25519",
+			X:         encode(public),
+		}, nil
+	default:
+		return JWK{}, ErrAlgorithm
+	}
+}
+
+// PublicKey decodes the key.
+func (j JWK) PublicKey() (crypto.PublicKey, error) {
+	switch {
+	case j.KeyType == "RSA" && j.Algorithm == RS256:
+		n, err := decode(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(j.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 || exponent.Int64() < 3 {
+			return nil, errors.New("jwt: invalid RSA exponent")
+		}
+		public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+		if public.N.BitLen() < minRSABits {
+			return nil, errors.New("jwt: RSA keys must have at least 2048 bits")
+		}
+		return public, nil
+	case j.KeyType == "OKP" && j.Curve == "Ed25519" && j.Algorithm == EdDSA:
+		x, err := decode(j.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("jwt: invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, ErrAlgorithm
+	}
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Key returns the key with the id.
+func (s JWKS) Key(id string) (JWK, bool) {
+	for _, key := range s.Keys {
+		if key.KeyID == id {
+			return key, true
+		}
+	}
+	return JWK{}, false
+}
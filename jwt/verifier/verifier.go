@@ -0,0 +1,263 @@
+// Package verifier verifies offline the JWTs minted by the jwt package,
+// against a static key set or one fetched from a JWKS endpoint.
+//
+//	keys := verifier.NewRemoteKeys("https://edge/.well-known/jwks.json", nil, time.Hour)
+//	v := verifier.New(keys, verifier.Options{Issuer: "edge", Audience: "orders"})
+//	mux.Handle("/", v.Middleware(app))
+package verifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stone-payments/globalidentity-go/internal/singleflight"
+	"github.com/stone-payments/globalidentity-go/jwt"
+)
+
+const minRefetchInterval = 10 * time.Second
+
+var (
+	// ErrUnknownKey is returned for tokens signed with a key missing from
+	// the key set.
+	ErrUnknownKey = errors.New("verifier: unknown key")
+	// ErrExpired is returned for expired tokens.
+	ErrExpired = errors.New("verifier: token expired")
+	// ErrNotYetValid is returned for tokens used before their "nbf" or "iat".
+	ErrNotYetValid = errors.New("verifier: token not yet valid")
+	// ErrIssuer is returned for tokens from another issuer.
+	ErrIssuer = errors.New("verifier: unexpected issuer")
+	// ErrAudience is returned for tokens not meant for the audience.
+	ErrAudience = errors.New("verifier: unexpected audience")
+)
+
+// KeySource provides the public keys tokens are verified with.
+type KeySource interface {
+	Key(id string) (jwt.JWK, error)
+}
+
+type staticKeys jwt.JWKS
+
+// StaticKeys returns a source serving the keys of jwks.
+func StaticKeys(jwks jwt.JWKS) KeySource {
+	return staticKeys(jwks)
+}
+
+func (s staticKeys) Key(id string) (jwt.JWK, error) {
+	if key, ok := jwt.JWKS(s).Key(id); ok {
+		return key, nil
+	}
+	return jwt.JWK{}, ErrUnknownKey
+}
+
+// RemoteKeys is a source fetching the key set from a JWKS endpoint. The set
+// is fetched again once older than the refresh interval, or when a token is
+// signed with an unknown key, at most every 10 seconds.
+type RemoteKeys struct {
+	url     string
+	client  *http.Client
+	refresh time.Duration
+	now     func() time.Time
+	flight  singleflight.Group
+
+	mutex     sync.Mutex
+	keys      jwt.JWKS
+	fetched   time.Time
+	attempted time.Time
+}
+
+// NewRemoteKeys returns a source fetching the key set from url with client,
+// or http.DefaultClient when nil.
+func NewRemoteKeys(url string, client *http.Client, refresh time.Duration) *RemoteKeys {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &RemoteKeys{url: url, client: client, refresh: refresh, now: time.Now}
+}
+
+// Key returns the key with the id, fetching the key set when needed. A
+// single fetch runs at a time, which callers missing the key wait for while
+// known keys keep being served, even when stale. When fetching fails the
+// keys fetched before keep being served.
+func (k *RemoteKeys) Key(id string) (jwt.JWK, error) {
+	k.mutex.Lock()
+	key, found := k.keys.Key(id)
+	fresh := found && !k.fetched.IsZero() && k.now().Sub(k.fetched) < k.refresh
+	k.mutex.Unlock()
+	if fresh {
+		return key, nil
+	}
+
+	var err error
+	if found {
+		if !k.attempt() {
+			return key, nil
+		}
+		_, err, _ = k.flight.Do(k.url, k.fetch)
+	} else {
+		_, err, _ = k.flight.Do(k.url, func() (interface{}, error) {
+			if !k.attempt() {
+				return nil, nil
+			}
+			return k.fetch()
+		})
+	}
+
+	k.mutex.Lock()
+	key, found = k.keys.Key(id)
+	k.mutex.Unlock()
+	if found {
+		return key, nil
+	}
+	if err != nil {
+		return jwt.JWK{}, err
+	}
+	return jwt.JWK{}, ErrUnknownKey
+}
+
+// attempt reports whether the key set may be fetched now, recording the
+// attempt if so.
+func (k *RemoteKeys) attempt() bool {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	now := k.now()
+	if !k.attempted.IsZero() && now.Sub(k.attempted) < minRefetchInterval {
+		return false
+	}
+	k.attempted = now
+	return true
+}
+
+// fetch fetches the key set without holding the lock, then stores it.
+func (k *RemoteKeys) fetch() (interface{}, error) {
+	response, err := k.client.Get(k.url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("verifier: fetching %s: %s", k.url, response.Status)
+	}
+
+	var keys jwt.JWKS
+	if err = json.NewDecoder(response.Body).Decode(&keys); err != nil {
+		return nil, err
+	}
+	k.mutex.Lock()
+	k.keys = keys
+	k.fetched = k.now()
+	k.mutex.Unlock()
+	return nil, nil
+}
+
+// Options configures a Verifier.
+type Options struct {
+	// Issuer, when set, must be the "iss" claim.
+	Issuer string
+	// Audience, when set, must be among the "aud" claim.
+	Audience string
+	// Leeway tolerates clock skew when checking times.
+	Leeway time.Duration
+}
+
+// Verifier verifies tokens against the keys of a KeySource.
+type Verifier struct {
+	keys    KeySource
+	options Options
+	now     func() time.Time
+}
+
+// New returns a verifier checking signatures with keys.
+func New(keys KeySource, options Options) *Verifier {
+	return &Verifier{keys: keys, options: options, now: time.Now}
+}
+
+// Verify checks the signature, times, issuer and audience of token and
+// returns its claims.
+func (v *Verifier) Verify(token string) (*jwt.Claims, error) {
+	parsed, err := jwt.Parse(token)
+	if err != nil {
+		return nil, err
+	}
+	jwk, err := v.keys.Key(parsed.Header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if jwk.Algorithm != parsed.Header.Algorithm {
+		return nil, jwt.ErrAlgorithm
+	}
+	public, err := jwk.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if err = parsed.Verify(public); err != nil {
+		return nil, err
+	}
+
+	claims := &parsed.Claims
+	now := v.now()
+	leeway := int64(v.options.Leeway / time.Second)
+	if claims.ExpiresAt == 0 || now.Unix() >= claims.ExpiresAt+leeway {
+		return nil, ErrExpired
+	}
+	if now.Unix()+leeway < claims.NotBefore || now.Unix()+leeway < claims.IssuedAt {
+		return nil, ErrNotYetValid
+	}
+	if v.options.Issuer != "" && claims.Issuer != v.options.Issuer {
+		return nil, ErrIssuer
+	}
+	if v.options.Audience != "" && !claims.Audience.Contains(v.options.Audience) {
+		return nil, ErrAudience
+	}
+	return claims, nil
+}
+
+type claimsKey struct{}
+
+// NewContext returns a copy of ctx carrying the claims.
+func NewContext(ctx context.Context, claims *jwt.Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// FromContext returns the claims stored in ctx, if any.
+func FromContext(ctx context.Context) (*jwt.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*jwt.Claims)
+	return claims, ok && claims != nil
+}
+
+// Middleware answers 401 to requests without a valid bearer token and
+// passes the others to next with the claims in their context. The context
+// also carries a core.Authorization holding the token and the subject as
+// user key.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if len(header) <= 7 || !strings.EqualFold(header[:7], "bearer ") {
+			unauthenticated(w)
+			return
+		}
+		token := strings.TrimSpace(header[7:])
+		claims, err := v.Verify(token)
+		if err != nil {
+			unauthenticated(w)
+			return
+		}
+
+		ctx := NewContext(r.Context(), claims)
+		ctx = core.NewContext(ctx, &core.Authorization{Token: token, Key: claims.Subject})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func unauthenticated(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{"error": "unauthenticated"})
+}
@@ -0,0 +1,208 @@
+package verifier
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stone-payments/globalidentity-go/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+var now = time.Unix(1000, 0)
+
+func generate(t *testing.T, algorithm string) *jwt.Key {
+	key, err := jwt.GenerateKey(algorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func sign(t *testing.T, key *jwt.Key, claims jwt.Claims) string {
+	signed, err := jwt.Sign(key, &claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func valid() jwt.Claims {
+	return jwt.Claims{Issuer: "edge", Subject: "key", Audience: jwt.Audience{"orders"}, IssuedAt: 990, ExpiresAt: 1100, Roles: []string{"admin"}}
+}
+
+func newVerifier(key *jwt.Key, options Options) *Verifier {
+	v := New(StaticKeys(jwt.JWKS{Keys: []jwt.JWK{key.JWK()}}), options)
+	v.now = func() time.Time { return now }
+	return v
+}
+
+func TestVerify(t *testing.T) {
+	key := generate(t, jwt.EdDSA)
+	v := newVerifier(key, Options{Issuer: "edge", Audience: "orders", Leeway: 5 * time.Second})
+
+	claims, err := v.Verify(sign(t, key, valid()))
+	assert.Nil(t, err)
+	assert.Equal(t, "key", claims.Subject)
+	assert.True(t, claims.HasRole("admin"))
+
+	cases := []struct {
+		modify func(*jwt.Claims)
+		err    error
+	}{
+		{func(c *jwt.Claims) { c.ExpiresAt = 995 }, ErrExpired},
+		{func(c *jwt.Claims) { c.ExpiresAt = 0 }, ErrExpired},
+		{func(c *jwt.Claims) { c.NotBefore = 1010 }, ErrNotYetValid},
+		{func(c *jwt.Claims) { c.IssuedAt = 1010 }, ErrNotYetValid},
+		{func(c *jwt.Claims) { c.Issuer = "other" }, ErrIssuer},
+		{func(c *jwt.Claims) { c.Audience = jwt.Audience{"payments"} }, ErrAudience},
+	}
+	for _, c := range cases {
+		claims := valid()
+		c.modify(&claims)
+		_, err := v.Verify(sign(t, key, claims))
+		assert.Equal(t, c.err, err)
+	}
+
+	within := valid()
+	within.ExpiresAt = 998
+	within.NotBefore = 1003
+	_, err = v.Verify(sign(t, key, within))
+	assert.Nil(t, err)
+}
+
+func TestVerifyRejectsUnknownKeys(t *testing.T) {
+	v := newVerifier(generate(t, jwt.RS256), Options{})
+
+	_, err := v.Verify(sign(t, generate(t, jwt.RS256), valid()))
+	assert.Equal(t, ErrUnknownKey, err)
+
+	_, err = v.Verify("not.a.token")
+	assert.Equal(t, jwt.ErrMalformed, err)
+}
+
+func TestRemoteKeys(t *testing.T) {
+	first, second := generate(t, jwt.EdDSA), generate(t, jwt.EdDSA)
+	keyring := jwt.NewKeyring(first, time.Hour)
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		keyring.Handler().ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	clock := now
+	keys := NewRemoteKeys(server.URL, nil, time.Hour)
+	keys.now = func() time.Time { return clock }
+
+	_, err := keys.Key(first.ID)
+	assert.Nil(t, err)
+	_, err = keys.Key(first.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	keyring.Rotate(second)
+	_, err = keys.Key(second.ID)
+	assert.Equal(t, ErrUnknownKey, err, "refetching is throttled")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	clock = clock.Add(minRefetchInterval)
+	_, err = keys.Key(second.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+
+	clock = clock.Add(time.Hour)
+	server.Close()
+	_, err = keys.Key(first.ID)
+	assert.Nil(t, err, "keys are kept when refreshing fails")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+}
+
+func TestRemoteKeysServeDuringRefresh(t *testing.T) {
+	first, second := generate(t, jwt.EdDSA), generate(t, jwt.EdDSA)
+	keyring := jwt.NewKeyring(first, time.Hour)
+	var fetches int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fetches, 1) > 1 {
+			<-release
+		}
+		keyring.Handler().ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	clock := now
+	keys := NewRemoteKeys(server.URL, nil, time.Hour)
+	keys.now = func() time.Time { return clock }
+	_, err := keys.Key(first.ID)
+	assert.Nil(t, err)
+
+	keyring.Rotate(second)
+	clock = clock.Add(time.Hour)
+	refreshed := make(chan error, 2)
+	go func() {
+		_, err := keys.Key(first.ID)
+		refreshed <- err
+	}()
+	for atomic.LoadInt32(&fetches) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	go func() {
+		_, err := keys.Key(second.ID)
+		refreshed <- err
+	}()
+
+	_, err = keys.Key(first.ID)
+	assert.Nil(t, err, "a stale key is served while the set is fetched")
+	close(release)
+	assert.Nil(t, <-refreshed)
+	assert.Nil(t, <-refreshed, "a missing key waits for the fetch in flight")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+}
+
+func TestRemoteKeysFetchFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	_, err := NewRemoteKeys(server.URL, nil, time.Hour).Key("id")
+	assert.NotNil(t, err)
+	assert.NotEqual(t, ErrUnknownKey, err)
+}
+
+func TestMiddleware(t *testing.T) {
+	key := generate(t, jwt.EdDSA)
+	v := newVerifier(key, Options{Audience: "orders"})
+	token := sign(t, key, valid())
+
+	var claims *jwt.Claims
+	var authorization *core.Authorization
+	handler := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ = FromContext(r.Context())
+		authorization, _ = core.FromContext(r.Context())
+	}))
+
+	serve := func(header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	assert.Equal(t, http.StatusOK, serve("Bearer "+token).Code)
+	assert.Equal(t, "key", claims.Subject)
+	assert.Equal(t, &core.Authorization{Token: token, Key: "key"}, authorization)
+
+	for _, header := range []string{"", "Basic abc", "Bearer invalid"} {
+		recorder := serve(header)
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code, header)
+		assert.Contains(t, recorder.Header().Get("WWW-Authenticate"), "invalid_token")
+	}
+}
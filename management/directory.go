@@ -0,0 +1,166 @@
+package management
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	core "github.com/stone-payments/globalidentity-go"
+)
+
+// Directory keeps every user of the application in memory, indexed by email
+// and user key, and refreshes them in the background.
+type Directory struct {
+	manager      GlobalIdentityManager
+	interval     time.Duration
+	includeRoles bool
+	now          func() time.Time
+
+	mutex       sync.RWMutex
+	byEmail     map[string]core.User
+	byKey       map[string]core.User
+	refreshedAt time.Time
+	lastError   error
+
+	done chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+// defaultRefreshInterval is the refresh interval of directories created with
+// a non-positive interval.
+const defaultRefreshInterval = time.Minute
+
+// NewDirectory returns a directory refreshed every interval once started, or
+// every minute when interval is not positive.
+func NewDirectory(manager GlobalIdentityManager, interval time.Duration, includeRoles bool) *Directory {
+	if interval <= 0 {
+		interval = defaultRefreshInterval
+	}
+	return &Directory{
+		manager:      manager,
+		interval:     interval,
+		includeRoles: includeRoles,
+		now:          time.Now,
+		byEmail:      make(map[string]core.User),
+		byKey:        make(map[string]core.User),
+		done:         make(chan struct{}),
+	}
+}
+
+// Start loads the users and keeps refreshing them until Stop is called. The
+// error of the initial load is returned, but refreshing continues anyway.
+func (d *Directory) Start() error {
+	err := d.Refresh()
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				d.Refresh()
+			case <-d.done:
+				return
+			}
+		}
+	}()
+
+	return err
+}
+
+// Stop stops the background refresh and waits for it to return.
+func (d *Directory) Stop() {
+	d.once.Do(func() {
+		close(d.done)
+		d.wg.Wait()
+	})
+}
+
+// Refresh reloads every user. On error the previous users are kept and the
+// error is also available through LastError.
+func (d *Directory) Refresh() error {
+	users, err := ListAllUsers(d.manager, defaultPageSize, d.includeRoles)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.lastError = err
+	if err != nil {
+		return err
+	}
+
+	d.byEmail = make(map[string]core.User, len(users))
+	d.byKey = make(map[string]core.User, len(users))
+	for _, user := range users {
+		d.byEmail[strings.ToLower(user.Email)] = user
+		d.byKey[user.UserKey] = user
+	}
+	d.refreshedAt = d.now()
+
+	return nil
+}
+
+// ByEmail returns the user with the email, compared case-insensitively.
+func (d *Directory) ByEmail(email string) (core.User, bool) {
+	d.mutex.RLock()
+	user, found := d.byEmail[strings.ToLower(email)]
+	d.mutex.RUnlock()
+	return copyUser(user), found
+}
+
+// ByKey returns the user with the user key.
+func (d *Directory) ByKey(userKey string) (core.User, bool) {
+	d.mutex.RLock()
+	user, found := d.byKey[userKey]
+	d.mutex.RUnlock()
+	return copyUser(user), found
+}
+
+// Len returns the number of users in the directory.
+func (d *Directory) Len() int {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return len(d.byKey)
+}
+
+// RefreshedAt returns the time of the last successful refresh, or the zero
+// time if the users were never loaded.
+func (d *Directory) RefreshedAt() time.Time {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.refreshedAt
+}
+
+// Loaded reports whether the users were ever loaded.
+func (d *Directory) Loaded() bool {
+	return !d.RefreshedAt().IsZero()
+}
+
+// Staleness returns the time elapsed since the last successful refresh, or
+// the maximum duration if the users were never loaded, so staleness checks
+// fail until they are.
+func (d *Directory) Staleness() time.Duration {
+	refreshedAt := d.RefreshedAt()
+	if refreshedAt.IsZero() {
+		return math.MaxInt64
+	}
+	return d.now().Sub(refreshedAt)
+}
+
+// LastError returns the error of the last refresh, or nil if it succeeded.
+func (d *Directory) LastError() error {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.lastError
+}
+
+func copyUser(user core.User) core.User {
+	user.Roles = append([]string(nil), user.Roles...)
+	return user
+}
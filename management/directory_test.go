@@ -0,0 +1,79 @@
+package management
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stone-payments/globalidentity-go/management/managementtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirectory(t *testing.T) {
+	manager := managementtest.New(
+		core.User{UserKey: "key-a", Email: "A@email.com", Name: "A", Roles: []string{"ADMIN"}},
+		core.User{UserKey: "key-b", Email: "b@email.com", Name: "B"},
+	)
+
+	now := time.Now()
+	directory := NewDirectory(manager, time.Minute, true)
+	directory.now = func() time.Time { return now }
+	assert.False(t, directory.Loaded())
+	assert.True(t, directory.Staleness() > 24*time.Hour)
+
+	assert.Nil(t, directory.Refresh())
+	assert.True(t, directory.Loaded())
+	assert.Equal(t, 2, directory.Len())
+
+	user, found := directory.ByEmail("a@EMAIL.com")
+	assert.True(t, found)
+	assert.Equal(t, "key-a", user.UserKey)
+	assert.Equal(t, []string{"ADMIN"}, user.Roles)
+
+	user.Roles[0] = "CHANGED"
+	user, _ = directory.ByKey("key-a")
+	assert.Equal(t, []string{"ADMIN"}, user.Roles)
+
+	_, found = directory.ByKey("key-c")
+	assert.False(t, found)
+
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, 30*time.Second, directory.Staleness())
+
+	manager.Fail("ListUsers", errors.New("unavailable"))
+	assert.NotNil(t, directory.Refresh())
+	assert.NotNil(t, directory.LastError())
+	assert.Equal(t, 2, directory.Len())
+	assert.Equal(t, 30*time.Second, directory.Staleness())
+}
+
+func TestDirectoryBackgroundRefresh(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	manager := managementtest.New(core.User{UserKey: "key-a", Email: "a@email.com"})
+	directory := NewDirectory(manager, 5*time.Millisecond, false)
+	assert.Nil(t, directory.Start())
+	defer directory.Stop()
+
+	manager.Put(core.User{UserKey: "key-b", Email: "b@email.com"})
+
+	assert.Eventually(t, func() bool {
+		_, found := directory.ByKey("key-b")
+		return found
+	}, time.Second, time.Millisecond)
+}
+
+func TestDirectoryDefaultInterval(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	manager := managementtest.New(core.User{UserKey: "key-a", Email: "a@email.com"})
+	for _, interval := range []time.Duration{0, -time.Second} {
+		directory := NewDirectory(manager, interval, false)
+		assert.Equal(t, defaultRefreshInterval, directory.interval)
+
+		assert.Nil(t, directory.Start())
+		directory.Stop()
+	}
+}
@@ -0,0 +1,72 @@
+package management
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	core "github.com/stone-payments/globalidentity-go"
+)
+
+// Check lists a single user, verifying that Global Identity is reachable and
+// that it accepts both the application key and the API key.
+func (gim *globalIdentityManager) Check(ctx context.Context) *core.HealthReport {
+	report := core.NewHealthReport("management")
+
+	url := fmt.Sprintf(gim.globalIdentityHost+listUsers, gim.applicationKey, 1, 1, false)
+	requestOptions := gim.requestOptions()
+	requestOptions.Context = ctx
+
+	start := time.Now()
+	resp, err := gim.requester.Get(url, requestOptions)
+	report.Latency = time.Since(start)
+
+	if err != nil {
+		giErr, ok := err.(core.GlobalIdentityError)
+		status := giErr.StatusCode()
+		if !ok || status >= 500 || status == 0 {
+			report.Add(core.CheckReachable, err)
+			return report
+		}
+		report.Add(core.CheckReachable, nil)
+		switch status {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			report.Add(core.CheckAPIKey, fmt.Errorf("rejected with status %d", status))
+		default:
+			report.Add(core.CheckAPIKey, nil)
+			report.Add(core.CheckApplicationKey, fmt.Errorf("rejected with status %d", status))
+		}
+		return report
+	}
+
+	response := new(core.ListUsersResponse)
+	if err = resp.JSON(response); err != nil {
+		report.Add(core.CheckReachable, fmt.Errorf("invalid response: %v", err))
+		return report
+	}
+	report.Add(core.CheckReachable, nil)
+	report.Add(core.CheckAPIKey, nil)
+
+	if response.Response == nil {
+		report.Add(core.CheckApplicationKey, errors.New("response without status"))
+		return report
+	}
+	if !response.Success {
+		var messages []string
+		for _, operation := range response.OperationReport {
+			messages = append(messages, operation.Message)
+		}
+		report.Add(core.CheckApplicationKey, errors.New(strings.Join(messages, "; ")))
+		return report
+	}
+	report.Add(core.CheckApplicationKey, nil)
+	return report
+}
+
+// Ping returns the error of Check, or nil if the manager is healthy.
+func (gim *globalIdentityManager) Ping(ctx context.Context) error {
+	return gim.Check(ctx).Err()
+}
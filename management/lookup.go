@@ -0,0 +1,88 @@
+package management
+
+import (
+	"context"
+	"sync"
+
+	core "github.com/stone-payments/globalidentity-go"
+)
+
+const defaultLookupWorkers = 8
+
+// Limiter blocks until a call may proceed or the context is done.
+type Limiter interface {
+	Wait(ctx context.Context) error
+}
+
+// LookupOptions controls a bulk user lookup.
+type LookupOptions struct {
+	// Workers is the maximum number of concurrent User calls. It defaults to 8.
+	Workers int
+	// IncludeRoles is passed on to every User call.
+	IncludeRoles bool
+	// Limiter, when set, is waited on before every User call.
+	Limiter Limiter
+}
+
+// LookupResult is the outcome of looking up a single email.
+type LookupResult struct {
+	User *core.User
+	Err  error
+}
+
+// LookupUsers calls User for every distinct email, at most Workers at a time,
+// and returns the results keyed by email. Once ctx is done no new call is
+// made and the emails not yet looked up are reported with ctx.Err().
+func LookupUsers(ctx context.Context, manager GlobalIdentityManager, emails []string, options LookupOptions) map[string]LookupResult {
+	workers := options.Workers
+	if workers < 1 {
+		workers = defaultLookupWorkers
+	}
+
+	results := make(map[string]LookupResult, len(emails))
+	pending := make(chan string, len(emails))
+	for _, email := range emails {
+		if _, found := results[email]; found {
+			continue
+		}
+		results[email] = LookupResult{}
+		pending <- email
+	}
+	close(pending)
+
+	if workers > len(results) {
+		workers = len(results)
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for email := range pending {
+				result := lookupUser(ctx, manager, email, options)
+				mutex.Lock()
+				results[email] = result
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+func lookupUser(ctx context.Context, manager GlobalIdentityManager, email string, options LookupOptions) LookupResult {
+	if err := ctx.Err(); err != nil {
+		return LookupResult{Err: err}
+	}
+	if options.Limiter != nil {
+		if err := options.Limiter.Wait(ctx); err != nil {
+			return LookupResult{Err: err}
+		}
+	}
+
+	user, err := manager.User(email, options.IncludeRoles)
+	return LookupResult{User: user, Err: err}
+}
@@ -0,0 +1,72 @@
+package management
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/fortytw2/leaktest"
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stone-payments/globalidentity-go/management/managementtest"
+	"github.com/stretchr/testify/assert"
+)
+
+type limiterMock struct {
+	mutex sync.Mutex
+	calls int
+	limit int
+}
+
+func (l *limiterMock) Wait(ctx context.Context) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.calls++
+	if l.calls > l.limit {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+func TestLookupUsers(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	manager := managementtest.New(
+		core.User{Email: "a@email.com", Roles: []string{"ADMIN"}},
+		core.User{Email: "b@email.com"},
+	)
+
+	results := LookupUsers(context.Background(), manager, []string{"a@email.com", "b@email.com", "a@email.com", "c@email.com"}, LookupOptions{Workers: 2, IncludeRoles: true})
+
+	assert.Len(t, results, 3)
+	assert.Equal(t, 3, manager.Calls("User"))
+	assert.Equal(t, []string{"ADMIN"}, results["a@email.com"].User.Roles)
+	assert.Nil(t, results["b@email.com"].Err)
+	assert.IsType(t, core.GlobalIdentityError{}, results["c@email.com"].Err)
+}
+
+func TestLookupUsersCancelled(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	manager := managementtest.New(core.User{Email: "a@email.com"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := LookupUsers(ctx, manager, []string{"a@email.com", "b@email.com"}, LookupOptions{})
+
+	assert.Equal(t, context.Canceled, results["a@email.com"].Err)
+	assert.Equal(t, context.Canceled, results["b@email.com"].Err)
+	assert.Equal(t, 0, manager.Calls("User"))
+}
+
+func TestLookupUsersLimiter(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	manager := managementtest.New(core.User{Email: "a@email.com"}, core.User{Email: "b@email.com"})
+	limiter := &limiterMock{limit: 1}
+
+	results := LookupUsers(context.Background(), manager, []string{"a@email.com", "b@email.com"}, LookupOptions{Workers: 1, Limiter: limiter})
+
+	assert.Equal(t, 1, manager.Calls("User"))
+	assert.Nil(t, results["a@email.com"].Err)
+	assert.Equal(t, context.DeadlineExceeded, results["b@email.com"].Err)
+}
@@ -1,8 +1,12 @@
 package management
 
 const (
-	contentJSON   = "application/json"
-	listUserRoles = "/api/management/%s/users/%s/roles"
-	listUsers     = "/api/management/%s/users?page=%d&limit=%d&includeRoles=%t"
-	getUser       = "/api/management/%s/users/%s?includeRoles=%t"
+	contentJSON    = "application/json"
+	listUserRoles  = "/api/management/%s/users/%s/roles"
+	listUsers      = "/api/management/%s/users?page=%d&limit=%d&includeRoles=%t"
+	getUser        = "/api/management/%s/users/%s?includeRoles=%t"
+	createUser     = "/api/management/%s/users"
+	updateUser     = "/api/management/%s/users/%s"
+	addUserRoles   = "/api/management/%s/users/%s/roles"
+	removeUserRole = "/api/management/%s/users/%s/roles/%s"
 )
@@ -0,0 +1,296 @@
+// Package managementtest provides an in-memory management.Manager for tests
+// of code built on top of the management package.
+package managementtest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	core "github.com/stone-payments/globalidentity-go"
+)
+
+// Manager is an in-memory management.Manager. Users are keyed by email and
+// every role they hold is reported as active.
+type Manager struct {
+	mutex    sync.Mutex
+	users    map[string]core.User
+	failures map[string]error
+	calls    map[string]int
+	sequence int
+}
+
+// New returns a manager holding users. Users without a UserKey get one.
+func New(users ...core.User) *Manager {
+	m := &Manager{
+		users:    make(map[string]core.User),
+		failures: make(map[string]error),
+		calls:    make(map[string]int),
+	}
+	for _, user := range users {
+		m.Put(user)
+	}
+	return m
+}
+
+// Put stores the user, replacing any user with the same email.
+func (m *Manager) Put(user core.User) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.put(user)
+}
+
+// Delete removes the user with the given email.
+func (m *Manager) Delete(email string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.users, email)
+}
+
+// Users returns every stored user sorted by email.
+func (m *Manager) Users() []core.User {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.sortedUsers()
+}
+
+// Fail makes every later call to method, such as "User", return err. A nil
+// err clears the failure.
+func (m *Manager) Fail(method string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if err == nil {
+		delete(m.failures, method)
+		return
+	}
+	m.failures[method] = err
+}
+
+// Calls returns how many times method was called.
+func (m *Manager) Calls(method string) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.calls[method]
+}
+
+func (m *Manager) UserRoles(email string) ([]core.Role, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	user, err := m.find("UserRoles", email)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make([]core.Role, len(user.Roles))
+	for i, role := range user.Roles {
+		roles[i] = core.Role{Name: role, Active: true}
+	}
+	return roles, nil
+}
+
+func (m *Manager) RoleMap(email string, roles ...string) (map[string]bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	user, err := m.find("RoleMap", email)
+	if err != nil {
+		return nil, err
+	}
+
+	held := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		held[role] = contains(user.Roles, role)
+	}
+	return held, nil
+}
+
+func (m *Manager) ListUsers(pageNumber, pageSize int, includeRoles bool) (*core.ListUsersResponse, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.call("ListUsers"); err != nil {
+		return nil, err
+	}
+	if pageNumber < 1 || pageSize < 1 {
+		return nil, core.GlobalIdentityError([]string{"invalid page"})
+	}
+
+	users := m.sortedUsers()
+	lastPage := (len(users) + pageSize - 1) / pageSize
+	if lastPage == 0 {
+		lastPage = 1
+	}
+
+	response := &core.ListUsersResponse{
+		Users:     []core.User{},
+		FirstPage: 1,
+		LastPage:  lastPage,
+		TotalRows: len(users),
+		Response:  &core.Response{Success: true},
+	}
+	if pageNumber < lastPage {
+		response.NextPage = pageNumber + 1
+	}
+
+	start := (pageNumber - 1) * pageSize
+	for i := start; i < start+pageSize && i < len(users); i++ {
+		user := users[i]
+		if !includeRoles {
+			user.Roles = nil
+		}
+		response.Users = append(response.Users, user)
+	}
+	return response, nil
+}
+
+func (m *Manager) User(email string, includeRoles bool) (*core.User, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	user, err := m.find("User", email)
+	if err != nil {
+		return nil, err
+	}
+	if !includeRoles {
+		user.Roles = nil
+	}
+	return &user, nil
+}
+
+func (m *Manager) CreateUser(user core.User, password string) (*core.User, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.call("CreateUser"); err != nil {
+		return nil, err
+	}
+	if _, found := m.users[user.Email]; found {
+		return nil, core.GlobalIdentityError([]string{"user already exists"})
+	}
+
+	user.UserKey = ""
+	user = m.put(user)
+	return &user, nil
+}
+
+func (m *Manager) UpdateUser(user core.User) (*core.User, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	current, err := m.find("UpdateUser", user.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	current.Name = user.Name
+	current.Comment = user.Comment
+	current.Active = user.Active
+	m.users[current.Email] = current
+	return &current, nil
+}
+
+func (m *Manager) AddUserRoles(email string, roles ...string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	user, err := m.find("AddUserRoles", email)
+	if err != nil {
+		return err
+	}
+
+	for _, role := range roles {
+		if !contains(user.Roles, role) {
+			user.Roles = append(user.Roles, role)
+		}
+	}
+	m.users[email] = user
+	return nil
+}
+
+func (m *Manager) RemoveUserRoles(email string, roles ...string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	user, err := m.find("RemoveUserRoles", email)
+	if err != nil {
+		return err
+	}
+
+	kept := make([]string, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		if !contains(roles, role) {
+			kept = append(kept, role)
+		}
+	}
+	user.Roles = kept
+	m.users[email] = user
+	return nil
+}
+
+// Check reports the manager as healthy, unless Fail was called for "Check".
+func (m *Manager) Check(ctx context.Context) *core.HealthReport {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	report := core.NewHealthReport("management")
+	err := m.call("Check")
+	report.Add(core.CheckReachable, err)
+	if err == nil {
+		report.Add(core.CheckAPIKey, nil)
+		report.Add(core.CheckApplicationKey, nil)
+	}
+	return report
+}
+
+func (m *Manager) Ping(ctx context.Context) error {
+	return m.Check(ctx).Err()
+}
+
+func (m *Manager) call(method string) error {
+	m.calls[method]++
+	return m.failures[method]
+}
+
+func (m *Manager) find(method, email string) (core.User, error) {
+	if err := m.call(method); err != nil {
+		return core.User{}, err
+	}
+
+	user, found := m.users[email]
+	if !found {
+		return core.User{}, core.GlobalIdentityError([]string{"404"})
+	}
+	user.Roles = append([]string(nil), user.Roles...)
+	return user, nil
+}
+
+func (m *Manager) put(user core.User) core.User {
+	if user.UserKey == "" {
+		m.sequence++
+		user.UserKey = fmt.Sprintf("00000000-0000-0000-0000-%012d", m.sequence)
+	}
+	user.Roles = append([]string(nil), user.Roles...)
+	m.users[user.Email] = user
+	return user
+}
+
+func (m *Manager) sortedUsers() []core.User {
+	users := make([]core.User, 0, len(m.users))
+	for _, user := range m.users {
+		user.Roles = append([]string(nil), user.Roles...)
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Email < users[j].Email })
+	return users
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
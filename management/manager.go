@@ -1,9 +1,11 @@
 package management
 
 import (
+	"context"
 	"fmt"
 
 	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stone-payments/globalidentity-go/internal/singleflight"
 )
 
 type GlobalIdentityManager interface {
@@ -12,23 +14,121 @@ type GlobalIdentityManager interface {
 	User(email string, includeRoles bool) (*core.User, error)
 }
 
+// RoleMapper reports which of several roles a user holds.
+type RoleMapper interface {
+	RoleMap(email string, roles ...string) (map[string]bool, error)
+}
+
+// UserWriter creates and updates users and their roles.
+type UserWriter interface {
+	CreateUser(user core.User, password string) (*core.User, error)
+	UpdateUser(user core.User) (*core.User, error)
+	AddUserRoles(email string, roles ...string) error
+	RemoveUserRoles(email string, roles ...string) error
+}
+
+// Manager is implemented by the managers returned by New. The interfaces it
+// adds to GlobalIdentityManager are kept apart so existing implementations of
+// GlobalIdentityManager keep compiling; code accepting a
+// GlobalIdentityManager detects them with a type assertion.
+type Manager interface {
+	GlobalIdentityManager
+	RoleMapper
+	UserWriter
+	Check(ctx context.Context) *core.HealthReport
+	Ping(ctx context.Context) error
+}
+
 type globalIdentityManager struct {
 	applicationKey     string
 	apiKey             string
 	globalIdentityHost string
 	requester          core.Requester
+	endpoints          []core.Endpoint
+	failoverOptions    core.FailoverOptions
+	rateLimits         map[core.OperationClass]core.Limit
+	flight             *singleflight.Group
+}
+
+// Option configures a manager created with New.
+type Option func(*globalIdentityManager)
+
+// WithRequester makes the manager send its requests through requester.
+func WithRequester(requester core.Requester) Option {
+	return func(gim *globalIdentityManager) {
+		gim.requester = requester
+	}
+}
+
+// WithHosts makes the manager fail over between hosts, tried in order. The
+// host given to New is then ignored.
+func WithHosts(hosts ...string) Option {
+	return WithEndpoints(core.Hosts(hosts...), core.FailoverOptions{})
+}
+
+// WithEndpoints makes the manager fail over between weighted endpoints. The
+// host given to New is then ignored.
+func WithEndpoints(endpoints []core.Endpoint, options core.FailoverOptions) Option {
+	return func(gim *globalIdentityManager) {
+		gim.endpoints = endpoints
+		gim.failoverOptions = options
+	}
 }
 
-func New(applicationKey string, apiKey string, globalIdentityHost string) GlobalIdentityManager {
-	return &globalIdentityManager{
-		applicationKey,
-		apiKey,
-		globalIdentityHost,
-		core.NewRequester(),
+// WithoutCoalescing makes every User and UserRoles call send its own
+// request. By default concurrent identical calls share a single request.
+func WithoutCoalescing() Option {
+	return func(gim *globalIdentityManager) {
+		gim.flight = nil
 	}
 }
 
+// WithRateLimits limits the requests sent by the manager per operation
+// class. To share limits between managers, give them the same
+// core.RateLimitedRequester with WithRequester instead.
+func WithRateLimits(limits map[core.OperationClass]core.Limit) Option {
+	return func(gim *globalIdentityManager) {
+		gim.rateLimits = limits
+	}
+}
+
+func New(applicationKey string, apiKey string, globalIdentityHost string, options ...Option) Manager {
+	gim := &globalIdentityManager{
+		applicationKey:     applicationKey,
+		apiKey:             apiKey,
+		globalIdentityHost: globalIdentityHost,
+		requester:          core.NewRequester(),
+		flight:             new(singleflight.Group),
+	}
+	for _, option := range options {
+		option(gim)
+	}
+	if len(gim.endpoints) > 0 {
+		gim.requester = core.NewFailoverRequester(gim.endpoints, gim.requester, gim.failoverOptions)
+		gim.globalIdentityHost = ""
+	}
+	if len(gim.rateLimits) > 0 {
+		gim.requester = core.NewRateLimitedRequester(gim.requester, gim.rateLimits)
+	}
+	return gim
+}
+
 func (gim *globalIdentityManager) UserRoles(email string) ([]core.Role, error) {
+	value, err, shared := gim.flight.Do("userRoles\x00"+email, func() (interface{}, error) {
+		return gim.userRoles(email)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	roles := value.([]core.Role)
+	if shared {
+		roles = append([]core.Role(nil), roles...)
+	}
+	return roles, nil
+}
+
+func (gim *globalIdentityManager) userRoles(email string) ([]core.Role, error) {
 
 	url := fmt.Sprintf(gim.globalIdentityHost+listUserRoles, gim.applicationKey, email)
 
@@ -60,6 +160,29 @@ func (gim *globalIdentityManager) UserRoles(email string) ([]core.Role, error) {
 	return roles, nil
 }
 
+// RoleMap reports which of the roles the user actively holds, using a single
+// UserRoles lookup.
+func (gim *globalIdentityManager) RoleMap(email string, roles ...string) (map[string]bool, error) {
+	userRoles, err := gim.UserRoles(email)
+	if err != nil {
+		return nil, err
+	}
+
+	active := make(map[string]bool, len(userRoles))
+	for _, role := range userRoles {
+		if role.Active {
+			active[role.Name] = true
+		}
+	}
+
+	held := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		held[role] = active[role]
+	}
+
+	return held, nil
+}
+
 func (gim *globalIdentityManager) ListUsers(pageNumber, pageSize int, includeRoles bool) (*core.ListUsersResponse, error) {
 
 	url := fmt.Sprintf(gim.globalIdentityHost+listUsers, gim.applicationKey, pageNumber, pageSize, includeRoles)
@@ -82,6 +205,24 @@ func (gim *globalIdentityManager) ListUsers(pageNumber, pageSize int, includeRol
 }
 
 func (gim *globalIdentityManager) User(email string, includeRoles bool) (*core.User, error) {
+	key := fmt.Sprintf("user\x00%s\x00%t", email, includeRoles)
+	value, err, shared := gim.flight.Do(key, func() (interface{}, error) {
+		return gim.user(email, includeRoles)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user := value.(*core.User)
+	if shared {
+		copied := *user
+		copied.Roles = append([]string(nil), user.Roles...)
+		user = &copied
+	}
+	return user, nil
+}
+
+func (gim *globalIdentityManager) user(email string, includeRoles bool) (*core.User, error) {
 
 	url := fmt.Sprintf(gim.globalIdentityHost+getUser, gim.applicationKey, email, includeRoles)
 
@@ -102,6 +243,113 @@ func (gim *globalIdentityManager) User(email string, includeRoles bool) (*core.U
 	return &response.User, nil
 }
 
+// CreateUser creates the user with the given roles. The password may be empty
+// when the server is expected to generate one.
+func (gim *globalIdentityManager) CreateUser(user core.User, password string) (*core.User, error) {
+
+	url := fmt.Sprintf(gim.globalIdentityHost+createUser, gim.applicationKey)
+
+	requestOptions := gim.requestOptions()
+	requestOptions.JSON = &createUserRequest{
+		Email:    user.Email,
+		Name:     user.Name,
+		Comment:  user.Comment,
+		Active:   user.Active,
+		Password: password,
+		Roles:    user.Roles,
+	}
+
+	resp, err := gim.requester.Post(url, requestOptions)
+
+	if err != nil {
+		return nil, err
+	}
+
+	response := new(userResponse)
+	if err = resp.JSON(&response); err != nil {
+		return nil, err
+	}
+	if err = response.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &response.User, nil
+}
+
+// UpdateUser updates the name, comment and active flag of the user identified
+// by user.Email. Roles are changed with AddUserRoles and RemoveUserRoles.
+func (gim *globalIdentityManager) UpdateUser(user core.User) (*core.User, error) {
+
+	url := fmt.Sprintf(gim.globalIdentityHost+updateUser, gim.applicationKey, user.Email)
+
+	requestOptions := gim.requestOptions()
+	requestOptions.JSON = &updateUserRequest{
+		Name:    user.Name,
+		Comment: user.Comment,
+		Active:  user.Active,
+	}
+
+	resp, err := core.Put(gim.requester, url, requestOptions)
+
+	if err != nil {
+		return nil, err
+	}
+
+	response := new(userResponse)
+	if err = resp.JSON(&response); err != nil {
+		return nil, err
+	}
+	if err = response.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &response.User, nil
+}
+
+func (gim *globalIdentityManager) AddUserRoles(email string, roles ...string) error {
+
+	url := fmt.Sprintf(gim.globalIdentityHost+addUserRoles, gim.applicationKey, email)
+
+	requestOptions := gim.requestOptions()
+	requestOptions.JSON = &userRolesRequest{Roles: roles}
+
+	resp, err := gim.requester.Post(url, requestOptions)
+
+	if err != nil {
+		return err
+	}
+
+	response := new(core.Response)
+	if err = resp.JSON(&response); err != nil {
+		return err
+	}
+
+	return response.Validate()
+}
+
+func (gim *globalIdentityManager) RemoveUserRoles(email string, roles ...string) error {
+
+	for _, role := range roles {
+		url := fmt.Sprintf(gim.globalIdentityHost+removeUserRole, gim.applicationKey, email, role)
+
+		resp, err := core.Delete(gim.requester, url, gim.requestOptions())
+
+		if err != nil {
+			return err
+		}
+
+		response := new(core.Response)
+		if err = resp.JSON(&response); err != nil {
+			return err
+		}
+		if err = response.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (gim *globalIdentityManager) requestOptions() *core.RequestOptions {
 	ro := new(core.RequestOptions)
 	ro.Headers = map[string]string{
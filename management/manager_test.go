@@ -1,8 +1,11 @@
 package management
 
 import (
+	"context"
 	"net/http"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/fortytw2/leaktest"
 	"github.com/jarcoal/httpmock"
@@ -16,7 +19,10 @@ type ManagementSuite struct {
 	userRolesUrl         string
 	getUserUrl           string
 	listUsersUrl         string
-	manager              GlobalIdentityManager
+	createUserUrl        string
+	updateUserUrl        string
+	userRoleUrl          string
+	manager              Manager
 	errorResponder       httpmock.Responder
 	okUserRolesResponder httpmock.Responder
 	okListUsersResponder httpmock.Responder
@@ -34,6 +40,9 @@ func (suite *ManagementSuite) SetupTest() {
 	suite.userRolesUrl = "http://userRolesUrl/api/management/key/users/user/roles"
 	suite.getUserUrl = "http://userRolesUrl/api/management/key/users/email?includeRoles=true"
 	suite.listUsersUrl = "http://userRolesUrl/api/management/key/users?page=1&limit=1&includeRoles=true"
+	suite.createUserUrl = "http://userRolesUrl/api/management/key/users"
+	suite.updateUserUrl = "http://userRolesUrl/api/management/key/users/email"
+	suite.userRoleUrl = "http://userRolesUrl/api/management/key/users/email/roles"
 
 	suite.okUserRolesResponder = httpmock.NewStringResponder(http.StatusOK, `{"Success": true, "OperationReport": [], "roles":[{"statusName":"mock"}]}`)
 	suite.okGetUserResponder = httpmock.NewStringResponder(http.StatusOK, `{ "OperationReport": [], "Success": true, "user": { "active": true, "comment": "Comments about the user in the application", "email": "user1@email.com", "lockedOut": false, "name": "User's name", "roles": [ "ADMIN" ], "userKey": "00000000-0000-0000-0000-000000000000" } }`)
@@ -210,3 +219,182 @@ func (suite *ManagementSuite) TestUserFailedResponse() {
 	assert.Nil(suite.T(), user)
 	assert.True(suite.T(), ok)
 }
+
+func (suite *ManagementSuite) TestRoleMapOk() {
+	defer leaktest.Check(suite.T())()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", suite.userRolesUrl, httpmock.NewStringResponder(http.StatusOK, `{"Success": true, "OperationReport": [], "roles":[{"roleName":"ADMIN","active":true},{"roleName":"FINANCE","active":false}]}`))
+
+	roles, err := suite.manager.RoleMap("user", "ADMIN", "FINANCE", "OPERATOR")
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), map[string]bool{"ADMIN": true, "FINANCE": false, "OPERATOR": false}, roles)
+}
+
+func (suite *ManagementSuite) TestRoleMapErrorResponse() {
+	defer leaktest.Check(suite.T())()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", suite.userRolesUrl, suite.errorResponder)
+
+	roles, err := suite.manager.RoleMap("user", "ADMIN")
+
+	assert.Nil(suite.T(), roles)
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *ManagementSuite) TestCreateUserOk() {
+	defer leaktest.Check(suite.T())()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", suite.createUserUrl, suite.okGetUserResponder)
+
+	user, err := suite.manager.CreateUser(core.User{Email: "user1@email.com", Roles: []string{"ADMIN"}}, "secret")
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "00000000-0000-0000-0000-000000000000", user.UserKey)
+}
+
+func (suite *ManagementSuite) TestCreateUserFailedResponse() {
+	defer leaktest.Check(suite.T())()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", suite.createUserUrl, suite.failedResponder)
+
+	user, err := suite.manager.CreateUser(core.User{Email: "user1@email.com"}, "")
+
+	_, ok := err.(core.GlobalIdentityError)
+
+	assert.Nil(suite.T(), user)
+	assert.True(suite.T(), ok)
+}
+
+func (suite *ManagementSuite) TestUpdateUserOk() {
+	defer leaktest.Check(suite.T())()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("PUT", suite.updateUserUrl, suite.okGetUserResponder)
+
+	user, err := suite.manager.UpdateUser(core.User{Email: "email", Name: "User's name"})
+
+	assert.Nil(suite.T(), err)
+	assert.NotNil(suite.T(), user)
+}
+
+func (suite *ManagementSuite) TestUpdateUserErrorResponse() {
+	defer leaktest.Check(suite.T())()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("PUT", suite.updateUserUrl, suite.errorResponder)
+
+	user, err := suite.manager.UpdateUser(core.User{Email: "email"})
+
+	assert.Nil(suite.T(), user)
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *ManagementSuite) TestAddUserRoles() {
+	defer leaktest.Check(suite.T())()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", suite.userRoleUrl, httpmock.NewStringResponder(http.StatusOK, `{"Success": true, "OperationReport": []}`))
+	assert.Nil(suite.T(), suite.manager.AddUserRoles("email", "ADMIN"))
+
+	httpmock.RegisterResponder("POST", suite.userRoleUrl, suite.failedResponder)
+	assert.NotNil(suite.T(), suite.manager.AddUserRoles("email", "ADMIN"))
+}
+
+func (suite *ManagementSuite) TestRemoveUserRoles() {
+	defer leaktest.Check(suite.T())()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("DELETE", suite.userRoleUrl+"/ADMIN", httpmock.NewStringResponder(http.StatusOK, `{"Success": true, "OperationReport": []}`))
+	httpmock.RegisterResponder("DELETE", suite.userRoleUrl+"/FINANCE", suite.errorResponder)
+
+	assert.Nil(suite.T(), suite.manager.RemoveUserRoles("email", "ADMIN"))
+	assert.NotNil(suite.T(), suite.manager.RemoveUserRoles("email", "ADMIN", "FINANCE"))
+}
+
+func (suite *ManagementSuite) TestWithHosts() {
+	defer leaktest.Check(suite.T())()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", "http://secondary/api/management/key/users/user/roles", suite.okUserRolesResponder)
+
+	manager := New("key", "key", "", WithHosts("http://unreachable", "http://secondary"))
+	roles, err := manager.UserRoles("user")
+
+	assert.Nil(suite.T(), err)
+	assert.True(suite.T(), len(roles) > 0)
+}
+
+func (suite *ManagementSuite) TestUserCoalescing() {
+	defer leaktest.Check(suite.T())()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	release := make(chan struct{})
+	httpmock.RegisterResponder("GET", suite.getUserUrl, func(req *http.Request) (*http.Response, error) {
+		<-release
+		return suite.okGetUserResponder(req)
+	})
+
+	users := make([]*core.User, 3)
+	var wg sync.WaitGroup
+	for i := range users {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			users[i], _ = suite.manager.User("email", true)
+		}(i)
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(suite.T(), 1, httpmock.GetTotalCallCount())
+	for _, user := range users {
+		assert.Equal(suite.T(), []string{"ADMIN"}, user.Roles)
+	}
+	users[0].Roles[0] = "CHANGED"
+	assert.Equal(suite.T(), "ADMIN", users[1].Roles[0])
+}
+
+func (suite *ManagementSuite) TestCheck() {
+	defer leaktest.Check(suite.T())()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	checkUrl := "http://userRolesUrl/api/management/key/users?page=1&limit=1&includeRoles=false"
+
+	httpmock.RegisterResponder("GET", checkUrl, suite.okListUsersResponder)
+	report := suite.manager.Check(context.Background())
+	assert.True(suite.T(), report.Healthy)
+	assert.Len(suite.T(), report.Checks, 3)
+	assert.Nil(suite.T(), suite.manager.Ping(context.Background()))
+
+	httpmock.RegisterResponder("GET", checkUrl, httpmock.NewStringResponder(http.StatusUnauthorized, ""))
+	report = suite.manager.Check(context.Background())
+	assert.False(suite.T(), report.Healthy)
+	assert.Equal(suite.T(), core.HealthCheck{Name: core.CheckAPIKey, Error: "rejected with status 401"}, report.Checks[1])
+
+	httpmock.RegisterResponder("GET", checkUrl, suite.failedResponder)
+	report = suite.manager.Check(context.Background())
+	assert.False(suite.T(), report.Healthy)
+	assert.False(suite.T(), report.Checks[2].OK)
+
+	httpmock.RegisterResponder("GET", checkUrl, suite.errorResponder)
+	report = suite.manager.Check(context.Background())
+	assert.False(suite.T(), report.Healthy)
+	assert.Len(suite.T(), report.Checks, 1)
+}
@@ -0,0 +1,20 @@
+package management
+
+type createUserRequest struct {
+	Email    string   `json:"email"`
+	Name     string   `json:"name"`
+	Comment  string   `json:"comment"`
+	Active   bool     `json:"active"`
+	Password string   `json:"password,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+}
+
+type updateUserRequest struct {
+	Name    string `json:"name"`
+	Comment string `json:"comment"`
+	Active  bool   `json:"active"`
+}
+
+type userRolesRequest struct {
+	Roles []string `json:"roles"`
+}
@@ -0,0 +1,412 @@
+package management
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	core "github.com/stone-payments/globalidentity-go"
+)
+
+// Format is a serialization format for user exports and imports.
+type Format string
+
+const (
+	// JSON is a single JSON array of users.
+	JSON Format = "json"
+	// NDJSON is one JSON user per line.
+	NDJSON Format = "ndjson"
+	// CSV is a header line followed by one user per line, roles separated by "|".
+	CSV Format = "csv"
+)
+
+const defaultPageSize = 100
+
+var csvColumns = []string{"userKey", "email", "name", "comment", "active", "lockedOut", "roles"}
+
+// ListAllUsers walks every page of ListUsers and returns all users of the
+// application.
+func ListAllUsers(manager GlobalIdentityManager, pageSize int, includeRoles bool) ([]core.User, error) {
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+
+	var users []core.User
+	for page := 1; ; {
+		response, err := manager.ListUsers(page, pageSize, includeRoles)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, response.Users...)
+
+		if len(response.Users) == 0 || response.NextPage <= page || page >= response.LastPage {
+			return users, nil
+		}
+		page = response.NextPage
+	}
+}
+
+// Export writes every user of the application, with roles, to w.
+func Export(manager GlobalIdentityManager, w io.Writer, format Format) error {
+	users, err := ListAllUsers(manager, defaultPageSize, true)
+	if err != nil {
+		return err
+	}
+	return WriteUsers(w, format, users)
+}
+
+// exportedUser is a user as written by WriteUsers. Its roles are always
+// written, even when empty, since Import leaves the roles of records without
+// them unchanged.
+type exportedUser struct {
+	core.User
+	Roles []string `json:"roles"`
+}
+
+// WriteUsers writes users to w, sorted by email with sorted roles so that
+// exports of the same data are identical.
+func WriteUsers(w io.Writer, format Format, users []core.User) error {
+	sorted := make([]exportedUser, len(users))
+	for i, user := range users {
+		roles := append([]string{}, user.Roles...)
+		sort.Strings(roles)
+		user.Roles = nil
+		sorted[i] = exportedUser{User: user, Roles: roles}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Email < sorted[j].Email })
+
+	switch format {
+	case JSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(sorted)
+	case NDJSON:
+		encoder := json.NewEncoder(w)
+		for _, user := range sorted {
+			if err := encoder.Encode(user); err != nil {
+				return err
+			}
+		}
+		return nil
+	case CSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(csvColumns); err != nil {
+			return err
+		}
+		for _, user := range sorted {
+			record := []string{
+				user.UserKey,
+				user.Email,
+				user.Name,
+				user.Comment,
+				strconv.FormatBool(user.Active),
+				strconv.FormatBool(user.LockedOut),
+				strings.Join(user.Roles, "|"),
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return fmt.Errorf("management: unknown format %q", format)
+	}
+}
+
+// Record is a user read from an import, along with its position in the input.
+// Line is the line number for NDJSON, the row number, counting the header as
+// row 1, for CSV and the element index, starting at 1, for JSON.
+type Record struct {
+	Line int
+	User core.User
+	// Fields holds the names of the fields set by the record, as named in
+	// JSON. Fields missing from a JSON or NDJSON record, or set to null, are
+	// absent; CSV records set every field.
+	Fields map[string]bool
+	Err    error
+}
+
+// ReadUsers reads users written in format. Malformed records are returned
+// with Err set; the returned error is reserved for unreadable input.
+func ReadUsers(r io.Reader, format Format) ([]Record, error) {
+	switch format {
+	case JSON:
+		var elements []json.RawMessage
+		if err := json.NewDecoder(r).Decode(&elements); err != nil {
+			return nil, err
+		}
+		records := make([]Record, len(elements))
+		for i, element := range elements {
+			records[i] = decodeRecord(i+1, element)
+		}
+		return records, nil
+	case NDJSON:
+		var records []Record
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			records = append(records, decodeRecord(line, []byte(text)))
+		}
+		return records, scanner.Err()
+	case CSV:
+		return readCSV(r)
+	default:
+		return nil, fmt.Errorf("management: unknown format %q", format)
+	}
+}
+
+// decodeRecord decodes a JSON user, rejecting unknown fields, and records
+// which fields it sets.
+func decodeRecord(line int, data []byte) Record {
+	record := Record{Line: line}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if record.Err = decoder.Decode(&record.User); record.Err != nil {
+		return record
+	}
+
+	var fields map[string]json.RawMessage
+	if record.Err = json.Unmarshal(data, &fields); record.Err != nil {
+		return record
+	}
+	record.Fields = make(map[string]bool, len(fields))
+	for name, value := range fields {
+		if string(bytes.TrimSpace(value)) == "null" {
+			continue
+		}
+		// Field names match case-insensitively, as when decoding the user.
+		for _, column := range csvColumns {
+			if strings.EqualFold(name, column) {
+				record.Fields[column] = true
+			}
+		}
+	}
+	return record
+}
+
+func readCSV(r io.Reader) ([]Record, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	// Every column is required: a missing one would read as empty or false
+	// and the import would clear the field, deactivate the user or revoke
+	// its roles.
+	for _, name := range csvColumns {
+		if _, found := columns[name]; !found {
+			return nil, fmt.Errorf("management: csv header has no %s column", name)
+		}
+	}
+
+	every := make(map[string]bool, len(csvColumns))
+	for _, name := range csvColumns {
+		every[name] = true
+	}
+
+	var records []Record
+	for line := 2; ; line++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				return nil, err
+			}
+			records = append(records, Record{Line: line, Err: err})
+			continue
+		}
+
+		value := func(name string) string {
+			if i, found := columns[name]; found && i < len(fields) {
+				return strings.TrimSpace(fields[i])
+			}
+			return ""
+		}
+		record := Record{Line: line, Fields: every}
+		record.User = core.User{
+			UserKey: value("userKey"),
+			Email:   value("email"),
+			Name:    value("name"),
+			Comment: value("comment"),
+		}
+		if roles := value("roles"); roles != "" {
+			record.User.Roles = strings.Split(roles, "|")
+		}
+		if record.User.Active, err = parseBool(value("active")); err != nil {
+			record.Err = fmt.Errorf("invalid active value: %v", err)
+		} else if record.User.LockedOut, err = parseBool(value("lockedOut")); err != nil {
+			record.Err = fmt.Errorf("invalid lockedOut value: %v", err)
+		}
+		records = append(records, record)
+	}
+}
+
+func parseBool(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// Import actions reported in ImportResult.
+const (
+	ImportCreated   = "created"
+	ImportUpdated   = "updated"
+	ImportUnchanged = "unchanged"
+	ImportFailed    = "failed"
+)
+
+// ImportResult is the outcome of importing a single record.
+type ImportResult struct {
+	Line   int
+	Email  string
+	Action string
+	Err    error
+}
+
+// ImportReport lists the outcome of every imported record.
+type ImportReport struct {
+	Results []ImportResult
+}
+
+// Failed returns the results of the records that could not be imported.
+func (r *ImportReport) Failed() []ImportResult {
+	var failed []ImportResult
+	for _, result := range r.Results {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Import reads users written in format and creates the missing ones, updates
+// the ones whose name, comment or active flag differ and grants and revokes
+// roles so that each user ends up with exactly the imported roles. Fields
+// absent from a record, roles included, are left unchanged; users created
+// from it get their zero value. Records are processed independently and their
+// errors are reported per record.
+func Import(manager Manager, r io.Reader, format Format) (*ImportReport, error) {
+	records, err := ReadUsers(r, format)
+	if err != nil {
+		return nil, err
+	}
+
+	report := new(ImportReport)
+	for _, record := range records {
+		result := ImportResult{Line: record.Line, Email: record.User.Email}
+		if record.Err == nil && record.User.Email == "" {
+			record.Err = fmt.Errorf("missing email")
+		}
+		if record.Err != nil {
+			result.Action, result.Err = ImportFailed, record.Err
+		} else {
+			result.Action, result.Err = importUser(manager, record.User, record.Fields)
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	return report, nil
+}
+
+func importUser(manager Manager, user core.User, fields map[string]bool) (string, error) {
+	current, err := manager.User(user.Email, true)
+	if err != nil {
+		if giErr, ok := err.(core.GlobalIdentityError); !ok || giErr.StatusCode() != http.StatusNotFound {
+			return ImportFailed, err
+		}
+		if _, err = manager.CreateUser(user, ""); err != nil {
+			return ImportFailed, err
+		}
+		return ImportCreated, nil
+	}
+
+	if !fields["name"] {
+		user.Name = current.Name
+	}
+	if !fields["comment"] {
+		user.Comment = current.Comment
+	}
+	if !fields["active"] {
+		user.Active = current.Active
+	}
+
+	action := ImportUnchanged
+	if current.Name != user.Name || current.Comment != user.Comment || current.Active != user.Active {
+		if _, err = manager.UpdateUser(user); err != nil {
+			return ImportFailed, err
+		}
+		action = ImportUpdated
+	}
+
+	if !fields["roles"] {
+		return action, nil
+	}
+	granted, revoked := DiffRoles(current.Roles, user.Roles)
+	if len(granted) > 0 {
+		if err = manager.AddUserRoles(user.Email, granted...); err != nil {
+			return ImportFailed, err
+		}
+		action = ImportUpdated
+	}
+	if len(revoked) > 0 {
+		if err = manager.RemoveUserRoles(user.Email, revoked...); err != nil {
+			return ImportFailed, err
+		}
+		action = ImportUpdated
+	}
+
+	return action, nil
+}
+
+// DiffRoles returns the roles present in desired but not in current, and the
+// roles present in current but not in desired, both sorted and without
+// duplicates.
+func DiffRoles(current, desired []string) (added []string, removed []string) {
+	currentSet := make(map[string]bool, len(current))
+	for _, role := range current {
+		currentSet[role] = true
+	}
+	desiredSet := make(map[string]bool, len(desired))
+	for _, role := range desired {
+		if !desiredSet[role] && !currentSet[role] {
+			added = append(added, role)
+		}
+		desiredSet[role] = true
+	}
+	for _, role := range current {
+		if !desiredSet[role] {
+			removed = append(removed, role)
+			desiredSet[role] = true
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// UniqueRoles returns roles sorted and without duplicates.
+func UniqueRoles(roles []string) []string {
+	unique, _ := DiffRoles(nil, roles)
+	return unique
+}
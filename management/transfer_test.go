@@ -0,0 +1,164 @@
+package management
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stone-payments/globalidentity-go/management/managementtest"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ Manager = managementtest.New()
+
+func transferUsers() []core.User {
+	return []core.User{
+		{UserKey: "2", Email: "b@email.com", Name: "B, the second", Active: true, Roles: []string{"USER", "ADMIN"}},
+		{UserKey: "1", Email: "a@email.com", Name: "A", Active: false, LockedOut: true},
+		{UserKey: "3", Email: "c@email.com", Name: "C", Active: true, Roles: []string{"USER"}},
+	}
+}
+
+func TestListAllUsers(t *testing.T) {
+	manager := managementtest.New(transferUsers()...)
+
+	users, err := ListAllUsers(manager, 2, true)
+
+	assert.Nil(t, err)
+	assert.Len(t, users, 3)
+	assert.Equal(t, 2, manager.Calls("ListUsers"))
+}
+
+func TestExportCSV(t *testing.T) {
+	var buffer bytes.Buffer
+
+	err := Export(managementtest.New(transferUsers()...), &buffer, CSV)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `userKey,email,name,comment,active,lockedOut,roles
+1,a@email.com,A,,false,true,
+2,b@email.com,"B, the second",,true,false,ADMIN|USER
+3,c@email.com,C,,true,false,USER
+`, buffer.String())
+}
+
+func TestExportReadRoundTrip(t *testing.T) {
+	for _, format := range []Format{JSON, NDJSON, CSV} {
+		var buffer bytes.Buffer
+		assert.Nil(t, WriteUsers(&buffer, format, transferUsers()))
+
+		records, err := ReadUsers(&buffer, format)
+		assert.Nil(t, err, string(format))
+		assert.Len(t, records, 3, string(format))
+		for _, record := range records {
+			assert.Nil(t, record.Err, string(format))
+		}
+		assert.Equal(t, "b@email.com", records[1].User.Email, string(format))
+		assert.Equal(t, []string{"ADMIN", "USER"}, records[1].User.Roles, string(format))
+		assert.True(t, records[0].User.LockedOut, string(format))
+	}
+
+	assert.NotNil(t, WriteUsers(&bytes.Buffer{}, Format("xml"), nil))
+}
+
+func TestImport(t *testing.T) {
+	manager := managementtest.New(
+		core.User{Email: "a@email.com", Name: "A", Active: true, Roles: []string{"USER"}},
+		core.User{Email: "b@email.com", Name: "B", Active: true, Roles: []string{"ADMIN"}},
+		core.User{Email: "c@email.com", Name: "C", Active: true, Roles: []string{"USER"}},
+	)
+
+	input := `userKey,email,name,comment,active,lockedOut,roles
+,a@email.com,A,,true,false,USER
+,b@email.com,B,,false,false,USER
+,c@email.com,C,,maybe,false,USER
+,d@email.com,D,,true,false,FINANCE|USER
+,,E,,true,false,
+`
+	report, err := Import(manager, strings.NewReader(input), CSV)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []ImportResult{
+		{Line: 2, Email: "a@email.com", Action: ImportUnchanged},
+		{Line: 3, Email: "b@email.com", Action: ImportUpdated},
+		{Line: 4, Email: "c@email.com", Action: ImportFailed, Err: report.Results[2].Err},
+		{Line: 5, Email: "d@email.com", Action: ImportCreated},
+		{Line: 6, Email: "", Action: ImportFailed, Err: report.Results[4].Err},
+	}, report.Results)
+	assert.Len(t, report.Failed(), 2)
+
+	user, _ := manager.User("b@email.com", true)
+	assert.False(t, user.Active)
+	assert.Equal(t, []string{"USER"}, user.Roles)
+
+	user, _ = manager.User("d@email.com", true)
+	assert.Equal(t, []string{"FINANCE", "USER"}, user.Roles)
+}
+
+func TestImportPartialRecords(t *testing.T) {
+	manager := managementtest.New(
+		core.User{UserKey: "1", Email: "a@email.com", Name: "A", Comment: "first", Active: true, Roles: []string{"ADMIN", "USER"}},
+		core.User{UserKey: "2", Email: "b@email.com", Name: "B", Comment: "second", Active: true, Roles: []string{"USER"}},
+	)
+
+	input := `{"email": "a@email.com"}
+{"email": "b@email.com", "name": "Bee", "roles": null}
+{"email": "c@email.com", "nmae": "typo"}
+`
+	report, err := Import(manager, strings.NewReader(input), NDJSON)
+	assert.Nil(t, err)
+	assert.Equal(t, ImportUnchanged, report.Results[0].Action)
+	assert.Equal(t, ImportUpdated, report.Results[1].Action)
+	assert.Equal(t, ImportFailed, report.Results[2].Action, "unknown fields are rejected")
+
+	user, _ := manager.User("a@email.com", true)
+	assert.Equal(t, core.User{UserKey: "1", Email: "a@email.com", Name: "A", Comment: "first", Active: true, Roles: []string{"ADMIN", "USER"}}, *user)
+	user, _ = manager.User("b@email.com", true)
+	assert.Equal(t, core.User{UserKey: "2", Email: "b@email.com", Name: "Bee", Comment: "second", Active: true, Roles: []string{"USER"}}, *user)
+	assert.Equal(t, 0, manager.Calls("CreateUser"))
+
+	report, err = Import(manager, strings.NewReader(`[{"email": "a@email.com", "active": false, "roles": []}]`), JSON)
+	assert.Nil(t, err)
+	assert.Equal(t, ImportUpdated, report.Results[0].Action)
+	user, _ = manager.User("a@email.com", true)
+	assert.Equal(t, core.User{UserKey: "1", Email: "a@email.com", Name: "A", Comment: "first"}, *user)
+}
+
+func TestImportUnavailable(t *testing.T) {
+	manager := managementtest.New()
+	manager.Fail("User", errors.New("connection refused"))
+
+	report, err := Import(manager, strings.NewReader(`{"email": "a@email.com"}`+"\n"), NDJSON)
+
+	assert.Nil(t, err)
+	assert.Equal(t, ImportFailed, report.Results[0].Action)
+	assert.Equal(t, 0, manager.Calls("CreateUser"))
+}
+
+func TestImportLookupFailure(t *testing.T) {
+	manager := managementtest.New()
+	manager.Fail("User", core.GlobalIdentityError([]string{"503"}))
+
+	report, err := Import(manager, strings.NewReader(`{"email": "a@email.com"}`+"\n"), NDJSON)
+
+	assert.Nil(t, err)
+	assert.Equal(t, ImportFailed, report.Results[0].Action)
+	assert.Equal(t, 0, manager.Calls("CreateUser"))
+}
+
+func TestReadUsersMissingColumn(t *testing.T) {
+	input := `email,name,comment,lockedOut,roles
+a@email.com,A,,false,USER
+`
+	_, err := ReadUsers(strings.NewReader(input), CSV)
+	assert.NotNil(t, err)
+
+	manager := managementtest.New(core.User{Email: "a@email.com", Name: "A", Active: true, Roles: []string{"USER"}})
+	_, err = Import(manager, strings.NewReader(input), CSV)
+	assert.NotNil(t, err)
+
+	user, _ := manager.User("a@email.com", true)
+	assert.True(t, user.Active)
+}
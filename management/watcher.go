@@ -0,0 +1,308 @@
+package management
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	core "github.com/stone-payments/globalidentity-go"
+)
+
+// EventType is the kind of change detected by a Watcher.
+type EventType string
+
+const (
+	UserCreated     EventType = "user_created"
+	UserDeactivated EventType = "user_deactivated"
+	UserLockedOut   EventType = "user_locked_out"
+	UserUnlocked    EventType = "user_unlocked"
+	RoleAdded       EventType = "role_added"
+	RoleRemoved     EventType = "role_removed"
+)
+
+// Event is a change to a user detected between two snapshots. Role is only
+// set for RoleAdded and RoleRemoved.
+type Event struct {
+	Type EventType `json:"type"`
+	User core.User `json:"user"`
+	Role string    `json:"role,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+// Snapshot is the list of users of the application at a given time.
+type Snapshot struct {
+	Time  time.Time   `json:"time"`
+	Users []core.User `json:"users"`
+}
+
+// SnapshotStore persists the last snapshot taken by a Watcher so changes
+// made while it was stopped are reported on restart.
+type SnapshotStore interface {
+	// Load returns the last saved snapshot, or nil if there is none.
+	Load() (*Snapshot, error)
+	Save(snapshot *Snapshot) error
+}
+
+type fileSnapshotStore struct {
+	filename string
+}
+
+// NewFileSnapshotStore returns a SnapshotStore keeping the snapshot as JSON in
+// filename.
+func NewFileSnapshotStore(filename string) SnapshotStore {
+	return fileSnapshotStore{filename}
+}
+
+func (s fileSnapshotStore) Load() (*Snapshot, error) {
+	data, err := ioutil.ReadFile(s.filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := new(Snapshot)
+	if err = json.Unmarshal(data, snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func (s fileSnapshotStore) Save(snapshot *Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(s.filename), filepath.Base(s.filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = temp.Write(data); err == nil {
+		err = temp.Close()
+	} else {
+		temp.Close()
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	return os.Rename(temp.Name(), s.filename)
+}
+
+// Watcher periodically lists the users of the application and emits an
+// event for every change since the previous snapshot. The first snapshot,
+// when no previous one was stored, only sets the baseline.
+type Watcher struct {
+	manager      GlobalIdentityManager
+	interval     time.Duration
+	includeRoles bool
+	store        SnapshotStore
+
+	events chan Event
+	errors chan error
+	done   chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+
+	mutex    sync.Mutex
+	previous *Snapshot
+	loaded   bool
+}
+
+// defaultWatchInterval is the polling interval of watchers created with a
+// non-positive interval.
+const defaultWatchInterval = time.Minute
+
+// NewWatcher returns a watcher listing users every interval, or every minute
+// when interval is not positive. Role changes are only detected when
+// includeRoles is true. The store may be nil.
+func NewWatcher(manager GlobalIdentityManager, interval time.Duration, includeRoles bool, store SnapshotStore) *Watcher {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	return &Watcher{
+		manager:      manager,
+		interval:     interval,
+		includeRoles: includeRoles,
+		store:        store,
+		events:       make(chan Event),
+		errors:       make(chan error, 1),
+		done:         make(chan struct{}),
+	}
+}
+
+// Events returns the channel events are delivered on. It is closed by Stop.
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+// Errors returns the channel polling errors are delivered on. Errors are
+// dropped when nobody is receiving them.
+func (w *Watcher) Errors() <-chan error {
+	return w.errors
+}
+
+// Start polls immediately and then every interval until Stop is called.
+func (w *Watcher) Start() {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			events, current, err := w.poll()
+			for _, event := range events {
+				select {
+				case w.events <- event:
+				case <-w.done:
+					return
+				}
+			}
+			if current != nil {
+				err = w.commit(current)
+			}
+			if err != nil {
+				w.report(err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-w.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops polling, waits for the polling goroutine to return and closes
+// the events channel. Events of a poll not yet received are dropped, but the
+// snapshot is only saved once every event of a poll has been received, so
+// with a store they are reported again, along with the ones already received
+// from that poll, when a new watcher starts.
+func (w *Watcher) Stop() {
+	w.once.Do(func() {
+		close(w.done)
+		w.wg.Wait()
+		close(w.events)
+	})
+}
+
+// Poll takes a snapshot, stores it and returns the changes since the
+// previous one. The snapshot is stored before the events are returned, so
+// events the caller fails to handle are not reported again; Start only
+// stores it after delivering them.
+func (w *Watcher) Poll() ([]Event, error) {
+	events, current, err := w.poll()
+	if current == nil {
+		return nil, err
+	}
+	return events, w.commit(current)
+}
+
+func (w *Watcher) report(err error) {
+	select {
+	case w.errors <- err:
+	default:
+	}
+}
+
+// poll takes a snapshot and returns the changes since the previous one
+// without replacing it; commit does.
+func (w *Watcher) poll() ([]Event, *Snapshot, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if !w.loaded && w.store != nil {
+		previous, err := w.store.Load()
+		if err != nil {
+			return nil, nil, err
+		}
+		w.previous = previous
+	}
+	w.loaded = true
+
+	users, err := ListAllUsers(w.manager, defaultPageSize, w.includeRoles)
+	if err != nil {
+		return nil, nil, err
+	}
+	current := &Snapshot{Time: time.Now(), Users: users}
+
+	var events []Event
+	if w.previous != nil {
+		events = DiffSnapshots(w.previous, current, w.includeRoles)
+	}
+	return events, current, nil
+}
+
+// commit makes current the baseline of the next poll and stores it. When
+// storing fails the baseline is still replaced, so the events are not
+// reported again by this watcher.
+func (w *Watcher) commit(current *Snapshot) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.previous = current
+	if w.store != nil {
+		return w.store.Save(current)
+	}
+	return nil
+}
+
+// DiffSnapshots returns the events leading from previous to current, ordered
+// by user email. Role changes are only reported when compareRoles is true.
+func DiffSnapshots(previous, current *Snapshot, compareRoles bool) []Event {
+	before := make(map[string]core.User, len(previous.Users))
+	for _, user := range previous.Users {
+		before[user.Email] = user
+	}
+
+	users := append([]core.User(nil), current.Users...)
+	sort.Slice(users, func(i, j int) bool { return users[i].Email < users[j].Email })
+
+	var events []Event
+	emit := func(eventType EventType, user core.User, role string) {
+		events = append(events, Event{Type: eventType, User: user, Role: role, Time: current.Time})
+	}
+
+	for _, user := range users {
+		old, found := before[user.Email]
+		if !found {
+			emit(UserCreated, user, "")
+			if compareRoles {
+				for _, role := range UniqueRoles(user.Roles) {
+					emit(RoleAdded, user, role)
+				}
+			}
+			continue
+		}
+
+		if old.Active && !user.Active {
+			emit(UserDeactivated, user, "")
+		}
+		if !old.LockedOut && user.LockedOut {
+			emit(UserLockedOut, user, "")
+		}
+		if old.LockedOut && !user.LockedOut {
+			emit(UserUnlocked, user, "")
+		}
+		if compareRoles {
+			added, removed := DiffRoles(old.Roles, user.Roles)
+			for _, role := range added {
+				emit(RoleAdded, user, role)
+			}
+			for _, role := range removed {
+				emit(RoleRemoved, user, role)
+			}
+		}
+	}
+
+	return events
+}
@@ -0,0 +1,124 @@
+package management
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stone-payments/globalidentity-go/management/managementtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func eventSummary(events []Event) [][2]string {
+	summary := make([][2]string, len(events))
+	for i, event := range events {
+		summary[i] = [2]string{string(event.Type), event.User.Email + " " + event.Role}
+	}
+	return summary
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	previous := &Snapshot{Users: []core.User{
+		{Email: "a@email.com", Active: true, Roles: []string{"USER"}},
+		{Email: "b@email.com", Active: true, LockedOut: true, Roles: []string{"USER"}},
+	}}
+	current := &Snapshot{Users: []core.User{
+		{Email: "c@email.com", Active: true, Roles: []string{"ADMIN"}},
+		{Email: "b@email.com", Active: true, Roles: []string{"ADMIN"}},
+		{Email: "a@email.com", Active: false, LockedOut: true, Roles: []string{"USER"}},
+	}}
+
+	assert.Equal(t, [][2]string{
+		{"user_deactivated", "a@email.com "},
+		{"user_locked_out", "a@email.com "},
+		{"user_unlocked", "b@email.com "},
+		{"role_added", "b@email.com ADMIN"},
+		{"role_removed", "b@email.com USER"},
+		{"user_created", "c@email.com "},
+		{"role_added", "c@email.com ADMIN"},
+	}, eventSummary(DiffSnapshots(previous, current, true)))
+
+	assert.Len(t, DiffSnapshots(previous, current, false), 4)
+}
+
+func TestWatcherPersistsSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watcher")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	store := NewFileSnapshotStore(filepath.Join(dir, "snapshot.json"))
+	manager := managementtest.New(core.User{Email: "a@email.com", Active: true, Roles: []string{"USER"}})
+
+	events, err := NewWatcher(manager, time.Minute, true, store).Poll()
+	assert.Nil(t, err)
+	assert.Empty(t, events)
+
+	assert.Nil(t, manager.AddUserRoles("a@email.com", "ADMIN"))
+
+	events, err = NewWatcher(manager, time.Minute, true, store).Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, [][2]string{{"role_added", "a@email.com ADMIN"}}, eventSummary(events))
+}
+
+func TestWatcherStartStop(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	manager := managementtest.New(core.User{Email: "a@email.com", Active: true})
+	watcher := NewWatcher(manager, 5*time.Millisecond, false, nil)
+	watcher.Start()
+
+	assert.Eventually(t, func() bool { return manager.Calls("ListUsers") > 0 }, time.Second, time.Millisecond)
+	manager.Put(core.User{Email: "b@email.com", Active: true})
+
+	select {
+	case event := <-watcher.Events():
+		assert.Equal(t, UserCreated, event.Type)
+		assert.Equal(t, "b@email.com", event.User.Email)
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+
+	watcher.Stop()
+	_, open := <-watcher.Events()
+	assert.False(t, open)
+}
+
+func TestWatcherDefaultInterval(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	manager := managementtest.New(core.User{Email: "a@email.com", Active: true})
+	for _, interval := range []time.Duration{0, -time.Second} {
+		watcher := NewWatcher(manager, interval, false, nil)
+		assert.Equal(t, defaultWatchInterval, watcher.interval)
+
+		watcher.Start()
+		watcher.Stop()
+	}
+}
+
+func TestWatcherStopBeforeDelivery(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	dir, err := ioutil.TempDir("", "watcher")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	store := NewFileSnapshotStore(filepath.Join(dir, "snapshot.json"))
+	manager := managementtest.New(core.User{Email: "a@email.com", Active: true})
+	_, err = NewWatcher(manager, time.Minute, false, store).Poll()
+	assert.Nil(t, err)
+
+	manager.Put(core.User{Email: "b@email.com", Active: true})
+	watcher := NewWatcher(manager, 5*time.Millisecond, false, store)
+	watcher.Start()
+	assert.Eventually(t, func() bool { return manager.Calls("ListUsers") > 1 }, time.Second, time.Millisecond)
+	watcher.Stop()
+
+	events, err := NewWatcher(manager, time.Minute, false, store).Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, [][2]string{{"user_created", "b@email.com "}}, eventSummary(events))
+}
@@ -3,6 +3,11 @@ package globalidentity
 type Authorization struct {
 	Token string
 	Key   string
+	// TokenExpirationInMinutes is the lifetime of Token, when known.
+	TokenExpirationInMinutes int
+	// Binding, when set, is the signature of a Binder binding Key to Token.
+	// Key is only trusted alongside a token when its binding verifies.
+	Binding string
 }
 
 type Role struct {
@@ -0,0 +1,157 @@
+package policy
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// RoleChecker answers role questions for a user. Any authorization.RoleChecker
+// satisfies it, such as the authorization.Manager returned by
+// authorization.New.
+type RoleChecker interface {
+	HasAnyRole(userKey string, roles ...string) (bool, error)
+	HasAllRoles(userKey string, roles ...string) (bool, error)
+}
+
+type roleSet map[string]bool
+
+// Roles returns a RoleChecker backed by roles already known for the user,
+// such as roles cached from management.UserRoles. The user key is ignored.
+func Roles(roles ...string) RoleChecker {
+	set := make(roleSet, len(roles))
+	for _, role := range roles {
+		set[role] = true
+	}
+	return set
+}
+
+func (s roleSet) HasAnyRole(userKey string, roles ...string) (bool, error) {
+	for _, role := range roles {
+		if s[role] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s roleSet) HasAllRoles(userKey string, roles ...string) (bool, error) {
+	for _, role := range roles {
+		if !s[role] {
+			return false, nil
+		}
+	}
+	return len(roles) > 0, nil
+}
+
+// Engine evaluates targets against a policy that can be replaced at runtime.
+type Engine struct {
+	mutex    sync.RWMutex
+	policy   *Policy
+	checker  RoleChecker
+	filename string
+	modTime  time.Time
+}
+
+// NewEngine returns an engine evaluating policy with checker.
+func NewEngine(policy *Policy, checker RoleChecker) *Engine {
+	return &Engine{policy: policy, checker: checker}
+}
+
+// LoadEngine returns an engine for the policy file, which can later be
+// reloaded with Reload or Watch.
+func LoadEngine(filename string, checker RoleChecker) (*Engine, error) {
+	engine := &Engine{checker: checker, filename: filename}
+	if err := engine.Reload(); err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+// Policy returns the policy currently in use.
+func (e *Engine) Policy() *Policy {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	return e.policy
+}
+
+// Update replaces the policy in use.
+func (e *Engine) Update(policy *Policy) {
+	e.mutex.Lock()
+	e.policy = policy
+	e.mutex.Unlock()
+}
+
+// Authorize reports whether the user may access the target.
+func (e *Engine) Authorize(target Target, userKey string) (bool, error) {
+	return evaluate(e.Policy(), target, userKey, e.checker)
+}
+
+// AuthorizeRoles reports whether a user holding roles may access the target,
+// without any remote call.
+func (e *Engine) AuthorizeRoles(target Target, roles ...string) bool {
+	return e.Policy().Allows(target, roles...)
+}
+
+// Reload reads the policy file again. The policy in use is kept when the file
+// cannot be loaded.
+func (e *Engine) Reload() error {
+	info, err := os.Stat(e.filename)
+	if err != nil {
+		return err
+	}
+
+	policy, err := Load(e.filename)
+	if err != nil {
+		return err
+	}
+
+	e.mutex.Lock()
+	e.policy = policy
+	e.modTime = info.ModTime()
+	e.mutex.Unlock()
+	return nil
+}
+
+// Watch reloads the policy file whenever its modification time changes,
+// checking every interval. Reload errors are passed to onError, which may be
+// nil. The returned function stops watching.
+func (e *Engine) Watch(interval time.Duration, onError func(error)) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := e.reloadIfChanged(); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+func (e *Engine) reloadIfChanged() error {
+	info, err := os.Stat(e.filename)
+	if err != nil {
+		return err
+	}
+
+	e.mutex.RLock()
+	changed := !info.ModTime().Equal(e.modTime)
+	e.mutex.RUnlock()
+
+	if !changed {
+		return nil
+	}
+	return e.Reload()
+}
@@ -0,0 +1,199 @@
+// Package policy maps HTTP routes and gRPC methods to the Global Identity
+// roles required to access them.
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// MatchAny requires at least one of the rule roles. It is the default.
+	MatchAny = "any"
+	// MatchAll requires every one of the rule roles.
+	MatchAll = "all"
+
+	// Allow grants access to targets not matched by any rule.
+	Allow = "allow"
+	// Deny refuses access to targets not matched by any rule. It is the default.
+	Deny = "deny"
+)
+
+// Rule requires Roles for the targets matched by Methods and Path, or by GRPC.
+//
+// Path and GRPC are path.Match patterns; a trailing "/**" matches everything
+// below the prefix. An empty Methods list matches every HTTP method and an
+// empty Roles list only requires an authenticated user.
+type Rule struct {
+	Methods []string `json:"methods,omitempty" yaml:"methods,omitempty"`
+	Path    string   `json:"path,omitempty" yaml:"path,omitempty"`
+	GRPC    string   `json:"grpc,omitempty" yaml:"grpc,omitempty"`
+	Roles   []string `json:"roles,omitempty" yaml:"roles,omitempty"`
+	Match   string   `json:"match,omitempty" yaml:"match,omitempty"`
+}
+
+// Policy is an ordered list of rules; the first rule matching a target wins.
+type Policy struct {
+	Default string `json:"default,omitempty" yaml:"default,omitempty"`
+	Rules   []Rule `json:"rules" yaml:"rules"`
+}
+
+// Target is the HTTP request or gRPC call being authorized. Path is cleaned
+// with path.Clean before matching, so dot segments cannot escape a rule.
+type Target struct {
+	Method     string
+	Path       string
+	GRPCMethod string
+}
+
+// HTTPTarget returns the target of an HTTP request.
+func HTTPTarget(method, path string) Target {
+	return Target{Method: method, Path: path}
+}
+
+// GRPCTarget returns the target of a gRPC call given its full method name.
+func GRPCTarget(fullMethod string) Target {
+	return Target{GRPCMethod: fullMethod}
+}
+
+// Load reads a policy file, decoding it as YAML or JSON based on its extension.
+func Load(filename string) (*Policy, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return ParseYAML(data)
+	default:
+		return ParseJSON(data)
+	}
+}
+
+// ParseJSON decodes and validates a JSON policy. Unknown fields are
+// rejected, as with ParseYAML.
+func ParseJSON(data []byte) (*Policy, error) {
+	policy := new(Policy)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(policy); err != nil {
+		return nil, err
+	}
+	return policy, policy.Validate()
+}
+
+// ParseYAML decodes and validates a YAML policy.
+func ParseYAML(data []byte) (*Policy, error) {
+	policy := new(Policy)
+	if err := yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, err
+	}
+	return policy, policy.Validate()
+}
+
+// Validate checks the policy for malformed rules.
+func (p *Policy) Validate() error {
+	if p.Default != "" && p.Default != Allow && p.Default != Deny {
+		return fmt.Errorf("policy: invalid default %q", p.Default)
+	}
+
+	for i, rule := range p.Rules {
+		if (rule.Path == "") == (rule.GRPC == "") {
+			return fmt.Errorf("policy: rule %d must have either a path or a grpc method", i)
+		}
+		if rule.Match != "" && rule.Match != MatchAny && rule.Match != MatchAll {
+			return fmt.Errorf("policy: rule %d has invalid match %q", i, rule.Match)
+		}
+		for _, pattern := range []string{rule.Path, rule.GRPC} {
+			if _, err := path.Match(strings.TrimSuffix(pattern, "/**"), ""); err != nil {
+				return fmt.Errorf("policy: rule %d has invalid pattern %q", i, pattern)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Rule returns the first rule matching the target.
+func (p *Policy) Rule(target Target) (*Rule, bool) {
+	for i := range p.Rules {
+		if p.Rules[i].matches(target) {
+			return &p.Rules[i], true
+		}
+	}
+	return nil, false
+}
+
+// Allows reports whether a user holding roles may access the target. It is
+// meant for tests checking a policy file against known users.
+func (p *Policy) Allows(target Target, roles ...string) bool {
+	allowed, _ := evaluate(p, target, "", Roles(roles...))
+	return allowed
+}
+
+func (r *Rule) matches(target Target) bool {
+	if target.GRPCMethod != "" {
+		return r.GRPC != "" && matchPattern(r.GRPC, target.GRPCMethod)
+	}
+
+	if r.Path == "" || !matchPattern(r.Path, cleanPath(target.Path)) {
+		return false
+	}
+	if len(r.Methods) == 0 {
+		return true
+	}
+	for _, method := range r.Methods {
+		if strings.EqualFold(method, target.Method) {
+			return true
+		}
+	}
+	return false
+}
+
+func cleanPath(name string) string {
+	if name == "" {
+		return name
+	}
+	return path.Clean(name)
+}
+
+func matchPattern(pattern, name string) bool {
+	if strings.HasSuffix(pattern, "/**") {
+		prefix := strings.TrimSuffix(pattern, "/**")
+		if name == prefix {
+			return true
+		}
+		segments := strings.Count(prefix, "/") + 1
+		parts := strings.SplitAfterN(name, "/", segments+1)
+		if len(parts) <= segments {
+			return false
+		}
+		matched, _ := path.Match(prefix, strings.TrimSuffix(strings.Join(parts[:segments], ""), "/"))
+		return matched
+	}
+
+	matched, _ := path.Match(pattern, name)
+	return matched
+}
+
+func evaluate(p *Policy, target Target, userKey string, checker RoleChecker) (bool, error) {
+	rule, found := p.Rule(target)
+	if !found {
+		return p.Default == Allow, nil
+	}
+	if len(rule.Roles) == 0 {
+		return true, nil
+	}
+	if rule.Match == MatchAll {
+		return checker.HasAllRoles(userKey, rule.Roles...)
+	}
+	return checker.HasAnyRole(userKey, rule.Roles...)
+}
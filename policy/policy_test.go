@@ -0,0 +1,103 @@
+package policy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+)
+
+const yamlPolicy = `
+default: deny
+rules:
+  - methods: [GET]
+    path: /reports/**
+    roles: [FINANCE, ADMIN]
+  - methods: [POST, DELETE]
+    path: /refunds/*
+    roles: [FINANCE, APPROVER]
+    match: all
+  - path: /health
+  - grpc: /payments.Refunds/*
+    roles: [ADMIN]
+`
+
+func TestParseYAML(t *testing.T) {
+	policy, err := ParseYAML([]byte(yamlPolicy))
+	assert.Nil(t, err)
+	assert.Len(t, policy.Rules, 4)
+
+	assert.True(t, policy.Allows(HTTPTarget("GET", "/reports/2019/07"), "FINANCE"))
+	assert.True(t, policy.Allows(HTTPTarget("GET", "/reports"), "ADMIN"))
+	assert.False(t, policy.Allows(HTTPTarget("POST", "/reports/2019"), "ADMIN"))
+	assert.False(t, policy.Allows(HTTPTarget("GET", "/reportsx"), "ADMIN"))
+
+	assert.False(t, policy.Allows(HTTPTarget("POST", "/refunds/1"), "FINANCE"))
+	assert.True(t, policy.Allows(HTTPTarget("POST", "/refunds/1"), "FINANCE", "APPROVER"))
+
+	assert.True(t, policy.Allows(HTTPTarget("GET", "/health")))
+	assert.True(t, policy.Allows(GRPCTarget("/payments.Refunds/Create"), "ADMIN"))
+	assert.False(t, policy.Allows(GRPCTarget("/payments.Refunds/Create"), "FINANCE"))
+	assert.False(t, policy.Allows(GRPCTarget("/payments.Charges/Create"), "ADMIN"))
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := ParseJSON([]byte(`{"default": "maybe", "rules": []}`))
+	assert.NotNil(t, err)
+
+	_, err = ParseJSON([]byte(`{"rules": [{"roles": ["ADMIN"]}]}`))
+	assert.NotNil(t, err)
+
+	_, err = ParseJSON([]byte(`{"rules": [{"path": "/a", "match": "some"}]}`))
+	assert.NotNil(t, err)
+
+	_, err = ParseYAML([]byte("rules:\n  - path: /a\n    role: [ADMIN]\n"))
+	assert.NotNil(t, err)
+
+	_, err = ParseJSON([]byte(`{"rules": [{"path": "/a", "role": ["ADMIN"]}]}`))
+	assert.NotNil(t, err, "unknown fields are rejected")
+}
+
+func TestCleanPaths(t *testing.T) {
+	policy, err := ParseYAML([]byte("rules:\n  - path: /admin/**\n    roles: [ADMIN]\n  - path: /**\n"))
+	assert.Nil(t, err)
+
+	assert.True(t, policy.Allows(HTTPTarget("GET", "/public/page")))
+	assert.False(t, policy.Allows(HTTPTarget("GET", "/public/../admin/users")))
+	assert.False(t, policy.Allows(HTTPTarget("GET", "/admin/./users")))
+	assert.False(t, policy.Allows(HTTPTarget("GET", "//admin/users")))
+	assert.True(t, policy.Allows(HTTPTarget("GET", "/admin/../public"), "VIEWER"))
+}
+
+func TestEngineReload(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	dir, err := ioutil.TempDir("", "policy")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "policy.json")
+	assert.Nil(t, ioutil.WriteFile(filename, []byte(`{"rules": [{"path": "/admin/**", "roles": ["ADMIN"]}]}`), 0600))
+
+	engine, err := LoadEngine(filename, Roles("OPERATOR"))
+	assert.Nil(t, err)
+
+	ok, err := engine.Authorize(HTTPTarget("GET", "/admin/users"), "user")
+	assert.False(t, ok)
+	assert.Nil(t, err)
+
+	stop := engine.Watch(10*time.Millisecond, nil)
+	defer stop()
+
+	assert.Nil(t, ioutil.WriteFile(filename, []byte(`{"rules": [{"path": "/admin/**", "roles": ["OPERATOR"]}]}`), 0600))
+	assert.Nil(t, os.Chtimes(filename, time.Now(), time.Now().Add(time.Second)))
+
+	assert.Eventually(t, func() bool {
+		ok, _ := engine.Authorize(HTTPTarget("GET", "/admin/users"), "user")
+		return ok
+	}, time.Second, 10*time.Millisecond)
+}
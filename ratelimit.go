@@ -0,0 +1,249 @@
+package globalidentity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OperationClass groups Global Identity requests sharing a rate limit.
+type OperationClass string
+
+const (
+	// Authentication covers user authentication, token renewal, password
+	// recovery and application validation.
+	Authentication OperationClass = "authentication"
+	// Validation covers token validation and role checks.
+	Validation OperationClass = "validation"
+	// ManagementRead covers management requests that do not change data.
+	ManagementRead OperationClass = "management_read"
+	// ManagementWrite covers management requests that change data.
+	ManagementWrite OperationClass = "management_write"
+)
+
+// RateLimitedError is returned by a RateLimitedRequester when a request is
+// refused locally, without being sent to Global Identity.
+type RateLimitedError struct {
+	Class OperationClass
+}
+
+func (e RateLimitedError) Error() string {
+	return fmt.Sprintf("globalidentity: %s request rate limited locally", e.Class)
+}
+
+const defaultMaxWait = 30 * time.Second
+
+// ErrBucketExhausted is returned by TokenBucket.Wait when the bucket is empty
+// and never refills, its Rate not being positive.
+var ErrBucketExhausted = errors.New("globalidentity: token bucket exhausted")
+
+// Limit is a token bucket refilled at Rate tokens per second and holding at
+// most Burst tokens. Requests wait for a token when Wait is true, until the
+// request context is done or MaxWait elapses, and are refused right away
+// otherwise. MaxWait defaults to 30 seconds.
+type Limit struct {
+	Rate    float64
+	Burst   int
+	Wait    bool
+	MaxWait time.Duration
+}
+
+// TokenBucket is a token bucket rate limiter safe for concurrent use.
+type TokenBucket struct {
+	limit Limit
+	now   func() time.Time
+
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a full TokenBucket enforcing limit.
+func NewTokenBucket(limit Limit) *TokenBucket {
+	if limit.Burst <= 0 {
+		limit.Burst = 1
+	}
+	if limit.MaxWait <= 0 {
+		limit.MaxWait = defaultMaxWait
+	}
+	return &TokenBucket{limit: limit, now: time.Now, tokens: float64(limit.Burst)}
+}
+
+// Allow takes a token if one is available right away.
+func (b *TokenBucket) Allow() bool {
+	return b.reserve(false) == 0
+}
+
+// Wait takes a token, waiting until one is available, ctx is done or the
+// MaxWait of the limit elapses. It fails right away when the token would only
+// be available after that, and with ErrBucketExhausted when it never would.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	delay := b.reserve(true)
+	if delay == 0 {
+		return nil
+	}
+	if delay < 0 {
+		return ErrBucketExhausted
+	}
+	deadline := b.now().Add(b.limit.MaxWait)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if b.now().Add(delay).After(deadline) {
+		b.cancel()
+		return context.DeadlineExceeded
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token and returns how long to wait before using it. When
+// no token is available and borrow is false, nothing is taken and a positive
+// duration is returned; when borrow is true but the bucket never refills,
+// nothing is taken and a negative duration is returned.
+func (b *TokenBucket) reserve(borrow bool) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := b.now()
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+		if b.tokens > float64(b.limit.Burst) {
+			b.tokens = float64(b.limit.Burst)
+		}
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	if !borrow {
+		return time.Duration(1<<63 - 1)
+	}
+	if b.limit.Rate <= 0 {
+		return -1
+	}
+
+	b.tokens--
+	return time.Duration(-b.tokens / b.limit.Rate * float64(time.Second))
+}
+
+// cancel gives back a token taken by reserve that was not used.
+func (b *TokenBucket) cancel() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.tokens++
+}
+
+// RateLimitedRequester limits the requests sent through next per operation
+// class. Requests of a class without a limit are sent right away.
+type RateLimitedRequester struct {
+	next    Requester
+	buckets map[OperationClass]*TokenBucket
+}
+
+// NewRateLimitedRequester returns a RateLimitedRequester enforcing limits on
+// the requests sent through next.
+func NewRateLimitedRequester(next Requester, limits map[OperationClass]Limit) *RateLimitedRequester {
+	buckets := make(map[OperationClass]*TokenBucket, len(limits))
+	for class, limit := range limits {
+		buckets[class] = NewTokenBucket(limit)
+	}
+	return &RateLimitedRequester{next: next, buckets: buckets}
+}
+
+// Bucket returns the bucket limiting class, or nil if class is not limited.
+// Batch jobs can wait on it before queuing work.
+func (r *RateLimitedRequester) Bucket(class OperationClass) *TokenBucket {
+	return r.buckets[class]
+}
+
+func (r *RateLimitedRequester) Post(url string, ro *RequestOptions) (*HttpResponse, error) {
+	if err := r.wait("POST", url, ro); err != nil {
+		return nil, err
+	}
+	return r.next.Post(url, ro)
+}
+
+func (r *RateLimitedRequester) Get(url string, ro *RequestOptions) (*HttpResponse, error) {
+	if err := r.wait("GET", url, ro); err != nil {
+		return nil, err
+	}
+	return r.next.Get(url, ro)
+}
+
+func (r *RateLimitedRequester) Put(url string, ro *RequestOptions) (*HttpResponse, error) {
+	if err := r.wait("PUT", url, ro); err != nil {
+		return nil, err
+	}
+	return Put(r.next, url, ro)
+}
+
+func (r *RateLimitedRequester) Delete(url string, ro *RequestOptions) (*HttpResponse, error) {
+	if err := r.wait("DELETE", url, ro); err != nil {
+		return nil, err
+	}
+	return Delete(r.next, url, ro)
+}
+
+func (r *RateLimitedRequester) wait(method, url string, ro *RequestOptions) error {
+	class := Classify(method, url)
+	bucket := r.buckets[class]
+	if bucket == nil {
+		return nil
+	}
+
+	if !bucket.limit.Wait {
+		if !bucket.Allow() {
+			return RateLimitedError{Class: class}
+		}
+		return nil
+	}
+
+	var ctx context.Context
+	if ro != nil {
+		ctx = ro.Context
+	}
+	if err := bucket.Wait(ctx); err != nil {
+		return RateLimitedError{Class: class}
+	}
+	return nil
+}
+
+// Classify returns the operation class of a Global Identity request, or an
+// empty class for requests it does not recognize.
+func Classify(method, url string) OperationClass {
+	path := strings.ToLower(url)
+	switch {
+	case strings.Contains(path, "/api/authorization/validatetoken"),
+		strings.Contains(path, "/api/authorization/isuserinroles"):
+		return Validation
+	case strings.Contains(path, "/api/authorization/"):
+		return Authentication
+	case strings.Contains(path, "/api/management/"):
+		if method == "GET" {
+			return ManagementRead
+		}
+		return ManagementWrite
+	}
+	return ""
+}
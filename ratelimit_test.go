@@ -0,0 +1,113 @@
+package globalidentity
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	assert.Equal(t, Authentication, Classify("POST", "http://gi/api/authorization/authenticate"))
+	assert.Equal(t, Authentication, Classify("POST", "http://gi/api/authorization/renewtoken"))
+	assert.Equal(t, Validation, Classify("POST", "http://gi/api/authorization/validateToken"))
+	assert.Equal(t, Validation, Classify("POST", "http://gi/api/authorization/isuserinroles"))
+	assert.Equal(t, ManagementRead, Classify("GET", "http://gi/api/management/app/users?page=1"))
+	assert.Equal(t, ManagementWrite, Classify("DELETE", "http://gi/api/management/app/users/u/roles/r"))
+	assert.Equal(t, OperationClass(""), Classify("GET", "http://gi/"))
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(0, 0)
+	bucket := NewTokenBucket(Limit{Rate: 2, Burst: 2})
+	bucket.now = func() time.Time { return now }
+
+	assert.True(t, bucket.Allow())
+	assert.True(t, bucket.Allow())
+	assert.False(t, bucket.Allow())
+
+	now = now.Add(500 * time.Millisecond)
+	assert.True(t, bucket.Allow())
+	assert.False(t, bucket.Allow())
+
+	now = now.Add(time.Hour)
+	assert.True(t, bucket.Allow())
+	assert.True(t, bucket.Allow())
+	assert.False(t, bucket.Allow())
+}
+
+func TestTokenBucketWait(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	bucket := NewTokenBucket(Limit{Rate: 100, Burst: 1})
+	assert.Nil(t, bucket.Wait(context.Background()))
+
+	start := time.Now()
+	assert.Nil(t, bucket.Wait(context.Background()))
+	assert.True(t, time.Since(start) >= 5*time.Millisecond)
+
+	slow := NewTokenBucket(Limit{Rate: 0.1, Burst: 1})
+	assert.Nil(t, slow.Wait(nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, slow.Wait(ctx))
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, slow.Wait(ctx))
+}
+
+func TestTokenBucketWaitBounded(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	never := NewTokenBucket(Limit{Burst: 1})
+	assert.Nil(t, never.Wait(nil))
+	assert.Equal(t, ErrBucketExhausted, never.Wait(nil))
+	assert.False(t, never.Allow())
+
+	slow := NewTokenBucket(Limit{Rate: 0.1, Burst: 1, MaxWait: time.Second})
+	assert.Nil(t, slow.Wait(nil))
+	assert.Equal(t, context.DeadlineExceeded, slow.Wait(nil))
+	assert.Equal(t, context.DeadlineExceeded, slow.Wait(context.Background()))
+}
+
+func TestRateLimitedRequester(t *testing.T) {
+	defer leaktest.Check(t)()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", "http://gi/api/authorization/validateToken", httpmock.NewStringResponder(http.StatusOK, "{}"))
+	httpmock.RegisterResponder("GET", "http://gi/api/management/app/users", httpmock.NewStringResponder(http.StatusOK, "{}"))
+
+	requester := NewRateLimitedRequester(NewRequester(), map[OperationClass]Limit{
+		Validation:     {Rate: 0.001, Burst: 1},
+		ManagementRead: {Rate: 0.001, Burst: 1, Wait: true},
+	})
+
+	_, err := requester.Post("http://gi/api/authorization/validateToken", &RequestOptions{})
+	assert.Nil(t, err)
+	_, err = requester.Post("http://gi/api/authorization/validateToken", &RequestOptions{})
+	assert.Equal(t, RateLimitedError{Class: Validation}, err)
+
+	_, err = requester.Get("http://gi/api/management/app/users", &RequestOptions{})
+	assert.Nil(t, err)
+
+	ro := &RequestOptions{}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ro.Context = ctx
+	_, err = requester.Get("http://gi/api/management/app/users", ro)
+	assert.Equal(t, RateLimitedError{Class: ManagementRead}, err)
+
+	_, err = requester.Get("http://gi/api/management/app/users", &RequestOptions{})
+	assert.Equal(t, RateLimitedError{Class: ManagementRead}, err, "waits are bounded without a context")
+
+	info := httpmock.GetCallCountInfo()
+	assert.Equal(t, 1, info["POST http://gi/api/authorization/validateToken"])
+	assert.Equal(t, 1, info["GET http://gi/api/management/app/users"])
+}
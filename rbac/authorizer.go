@@ -0,0 +1,93 @@
+package rbac
+
+import (
+	"errors"
+
+	"github.com/stone-payments/globalidentity-go/management"
+)
+
+// RoleSource returns the Global Identity roles currently held by a user.
+type RoleSource interface {
+	Roles(user string) ([]string, error)
+}
+
+type managementRoles struct {
+	manager management.GlobalIdentityManager
+}
+
+// ManagementRoles returns a RoleSource that fetches the active roles of a
+// user, identified by email, through management.UserRoles.
+func ManagementRoles(manager management.GlobalIdentityManager) RoleSource {
+	return managementRoles{manager}
+}
+
+func (s managementRoles) Roles(email string) ([]string, error) {
+	roles, err := s.manager.UserRoles(email)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		if role.Active {
+			names = append(names, role.Name)
+		}
+	}
+	return names, nil
+}
+
+// RoleChecker checks whether a user holds any of the roles. The
+// authorization.Manager returned by authorization.New implements it.
+type RoleChecker interface {
+	HasAnyRole(userKey string, roles ...string) (bool, error)
+}
+
+// Authorizer answers permission questions for Global Identity users.
+type Authorizer struct {
+	model   *Model
+	source  RoleSource
+	checker RoleChecker
+}
+
+// NewAuthorizer returns an authorizer that fetches the roles of the user
+// from source and resolves permissions locally.
+func NewAuthorizer(model *Model, source RoleSource) *Authorizer {
+	return &Authorizer{model: model, source: source}
+}
+
+// NewRoleCheckAuthorizer returns an authorizer that asks checker whether the
+// user, identified by user key, holds any of the roles granting a permission.
+func NewRoleCheckAuthorizer(model *Model, checker RoleChecker) *Authorizer {
+	return &Authorizer{model: model, checker: checker}
+}
+
+// HasPermission reports whether the user holds the permission.
+func (a *Authorizer) HasPermission(user string, permission string) (bool, error) {
+	if a.checker != nil {
+		roles := a.model.RolesGranting(permission)
+		if len(roles) == 0 {
+			return false, nil
+		}
+		return a.checker.HasAnyRole(user, roles...)
+	}
+
+	roles, err := a.source.Roles(user)
+	if err != nil {
+		return false, err
+	}
+	return a.model.Grants(permission, roles...), nil
+}
+
+// Permissions returns every permission held by the user. It requires an
+// authorizer created with NewAuthorizer.
+func (a *Authorizer) Permissions(user string) (map[string]bool, error) {
+	if a.source == nil {
+		return nil, errors.New("rbac: permissions require a role source")
+	}
+
+	roles, err := a.source.Roles(user)
+	if err != nil {
+		return nil, err
+	}
+	return a.model.Permissions(roles...), nil
+}
@@ -0,0 +1,157 @@
+// Package rbac maps the flat Global Identity roles to fine-grained
+// permissions, with role inheritance.
+package rbac
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Role lists the roles a role inherits from and the permissions it grants.
+// A permission ending in ":*" grants every permission with that prefix and
+// "*" grants every permission.
+type Role struct {
+	Inherits    []string `json:"inherits,omitempty" yaml:"inherits,omitempty"`
+	Permissions []string `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+}
+
+// Model is the set of known roles, keyed by Global Identity role name.
+type Model struct {
+	Roles map[string]Role `json:"roles" yaml:"roles"`
+}
+
+// Load reads a model file, decoding it as YAML or JSON based on its extension.
+func Load(filename string) (*Model, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	model := new(Model)
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, model)
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(model)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return model, model.Validate()
+}
+
+// Validate checks that inherited roles exist and that inheritance has no cycles.
+func (m *Model) Validate() error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(m.Roles))
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("rbac: role %q inherits from itself", name)
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+		for _, parent := range m.Roles[name].Inherits {
+			if _, found := m.Roles[parent]; !found {
+				return fmt.Errorf("rbac: role %q inherits from unknown role %q", name, parent)
+			}
+			if err := visit(parent); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+
+	for name := range m.Roles {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Expand returns the roles together with every role they inherit from, sorted.
+func (m *Model) Expand(roles ...string) []string {
+	seen := make(map[string]bool)
+
+	var visit func(name string)
+	visit = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		for _, parent := range m.Roles[name].Inherits {
+			visit(parent)
+		}
+	}
+	for _, role := range roles {
+		visit(role)
+	}
+
+	expanded := make([]string, 0, len(seen))
+	for role := range seen {
+		expanded = append(expanded, role)
+	}
+	sort.Strings(expanded)
+	return expanded
+}
+
+// Permissions returns every permission granted by the roles, directly or
+// through inheritance.
+func (m *Model) Permissions(roles ...string) map[string]bool {
+	permissions := make(map[string]bool)
+	for _, role := range m.Expand(roles...) {
+		for _, permission := range m.Roles[role].Permissions {
+			permissions[permission] = true
+		}
+	}
+	return permissions
+}
+
+// Grants reports whether the roles grant the permission.
+func (m *Model) Grants(permission string, roles ...string) bool {
+	for granted := range m.Permissions(roles...) {
+		if matchPermission(granted, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// RolesGranting returns the sorted names of the roles that grant the
+// permission, directly or through inheritance.
+func (m *Model) RolesGranting(permission string) []string {
+	var roles []string
+	for name := range m.Roles {
+		if m.Grants(permission, name) {
+			roles = append(roles, name)
+		}
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+func matchPermission(granted, permission string) bool {
+	if granted == "*" || granted == permission {
+		return true
+	}
+	return strings.HasSuffix(granted, ":*") && strings.HasPrefix(permission, strings.TrimSuffix(granted, "*"))
+}
@@ -0,0 +1,115 @@
+package rbac
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/jarcoal/httpmock"
+	"github.com/stone-payments/globalidentity-go/management"
+	"github.com/stretchr/testify/assert"
+)
+
+var model = &Model{Roles: map[string]Role{
+	"VIEWER":   {Permissions: []string{"refund:read"}},
+	"OPERATOR": {Inherits: []string{"VIEWER"}, Permissions: []string{"refund:create"}},
+	"ADMIN":    {Inherits: []string{"OPERATOR"}, Permissions: []string{"user:*"}},
+}}
+
+type checkerMock map[string][]string
+
+func (c checkerMock) HasAnyRole(userKey string, roles ...string) (bool, error) {
+	for _, held := range c[userKey] {
+		for _, role := range roles {
+			if held == role {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func TestModel(t *testing.T) {
+	assert.Nil(t, model.Validate())
+	assert.Equal(t, []string{"ADMIN", "OPERATOR", "VIEWER"}, model.Expand("ADMIN"))
+
+	assert.True(t, model.Grants("refund:create", "ADMIN"))
+	assert.True(t, model.Grants("user:delete", "ADMIN"))
+	assert.False(t, model.Grants("user:delete", "OPERATOR"))
+	assert.False(t, model.Grants("refund:create", "VIEWER"))
+
+	assert.Equal(t, []string{"ADMIN", "OPERATOR"}, model.RolesGranting("refund:create"))
+}
+
+func TestModelValidate(t *testing.T) {
+	unknown := &Model{Roles: map[string]Role{"ADMIN": {Inherits: []string{"ROOT"}}}}
+	assert.NotNil(t, unknown.Validate())
+
+	cycle := &Model{Roles: map[string]Role{
+		"A": {Inherits: []string{"B"}},
+		"B": {Inherits: []string{"A"}},
+	}}
+	assert.NotNil(t, cycle.Validate())
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rbac")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "roles.yaml")
+	assert.Nil(t, ioutil.WriteFile(filename, []byte("roles:\n  ADMIN:\n    inherits: [OPERATOR]\n  OPERATOR:\n    permissions: [refund:create]\n"), 0600))
+
+	loaded, err := Load(filename)
+	assert.Nil(t, err)
+	assert.True(t, loaded.Grants("refund:create", "ADMIN"))
+
+	filename = filepath.Join(dir, "roles.json")
+	assert.Nil(t, ioutil.WriteFile(filename, []byte(`{"roles": {"ADMIN": {"permissions": ["refund:create"]}}}`), 0600))
+	_, err = Load(filename)
+	assert.Nil(t, err)
+
+	assert.Nil(t, ioutil.WriteFile(filename, []byte(`{"roles": {"ADMIN": {"permission": ["refund:create"]}}}`), 0600))
+	_, err = Load(filename)
+	assert.NotNil(t, err, "unknown fields are rejected")
+}
+
+func TestRoleCheckAuthorizer(t *testing.T) {
+	authorizer := NewRoleCheckAuthorizer(model, checkerMock{"operator": {"OPERATOR"}})
+
+	ok, err := authorizer.HasPermission("operator", "refund:create")
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	ok, err = authorizer.HasPermission("operator", "user:create")
+	assert.False(t, ok)
+	assert.Nil(t, err)
+
+	_, err = authorizer.Permissions("operator")
+	assert.NotNil(t, err)
+}
+
+func TestManagementAuthorizer(t *testing.T) {
+	defer leaktest.Check(t)()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", "http://gi/api/management/key/users/user/roles", httpmock.NewStringResponder(http.StatusOK, `{"Success": true, "OperationReport": [], "roles":[{"roleName":"OPERATOR","active":true},{"roleName":"ADMIN","active":false}]}`))
+
+	authorizer := NewAuthorizer(model, ManagementRoles(management.New("key", "key", "http://gi")))
+
+	ok, err := authorizer.HasPermission("user", "refund:read")
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	ok, err = authorizer.HasPermission("user", "user:create")
+	assert.False(t, ok)
+	assert.Nil(t, err)
+
+	permissions, err := authorizer.Permissions("user")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]bool{"refund:read": true, "refund:create": true}, permissions)
+}
@@ -0,0 +1,115 @@
+package reconcile
+
+import (
+	"sync"
+
+	"github.com/stone-payments/globalidentity-go/management"
+)
+
+// Options controls how a plan is applied.
+type Options struct {
+	// Concurrency is the number of users changed at the same time. Actions on
+	// the same user always run in plan order. It defaults to 1.
+	Concurrency int
+	// DryRun reports every action as applied without calling the server.
+	DryRun bool
+}
+
+// Result is the outcome of a single action.
+type Result struct {
+	Action Action
+	Err    error
+}
+
+// Report lists the outcome of every action, in plan order.
+type Report struct {
+	Results []Result
+}
+
+// Failed returns the results of the actions that failed or were skipped
+// because an earlier action on the same user failed.
+func (r *Report) Failed() []Result {
+	var failed []Result
+	for _, result := range r.Results {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// SkippedError is reported for actions not attempted because an earlier
+// action on the same user failed.
+type SkippedError struct {
+	Cause error
+}
+
+func (e SkippedError) Error() string {
+	return "skipped: " + e.Cause.Error()
+}
+
+// Apply executes the plan.
+func Apply(plan *Plan, manager management.Manager, options Options) *Report {
+	concurrency := options.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	report := &Report{Results: make([]Result, len(plan.Actions))}
+
+	var groups [][]int
+	groupOf := make(map[string]int)
+	for i, action := range plan.Actions {
+		report.Results[i].Action = action
+		group, found := groupOf[action.Email]
+		if !found {
+			group = len(groups)
+			groupOf[action.Email] = group
+			groups = append(groups, nil)
+		}
+		groups[group] = append(groups[group], i)
+	}
+
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, group := range groups {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(group []int) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			var err error
+			for _, i := range group {
+				if err != nil {
+					report.Results[i].Err = SkippedError{Cause: err}
+					continue
+				}
+				if !options.DryRun {
+					err = execute(plan.Actions[i], manager)
+					report.Results[i].Err = err
+				}
+			}
+		}(group)
+	}
+	wg.Wait()
+
+	return report
+}
+
+func execute(action Action, manager management.Manager) error {
+	switch action.Kind {
+	case Create:
+		_, err := manager.CreateUser(*action.User, "")
+		return err
+	case Update:
+		_, err := manager.UpdateUser(*action.User)
+		return err
+	case Grant:
+		return manager.AddUserRoles(action.Email, action.Roles...)
+	default:
+		return manager.RemoveUserRoles(action.Email, action.Roles...)
+	}
+}
@@ -0,0 +1,135 @@
+package reconcile
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stone-payments/globalidentity-go/management"
+)
+
+// Kind is the kind of change made by an action.
+type Kind string
+
+const (
+	Create Kind = "create"
+	Update Kind = "update"
+	Grant  Kind = "grant"
+	Revoke Kind = "revoke"
+)
+
+// Action is a single change to a user. Create and Update carry the resulting
+// user; Grant and Revoke carry the roles.
+type Action struct {
+	Kind  Kind
+	Email string
+	User  *core.User
+	Roles []string
+}
+
+func (a Action) String() string {
+	switch a.Kind {
+	case Create:
+		return fmt.Sprintf("+ create %s (name=%q, active=%t, roles=[%s])", a.Email, a.User.Name, a.User.Active, strings.Join(a.User.Roles, ", "))
+	case Update:
+		return fmt.Sprintf("~ update %s (name=%q, comment=%q, active=%t)", a.Email, a.User.Name, a.User.Comment, a.User.Active)
+	case Grant:
+		return fmt.Sprintf("+ grant %s [%s]", a.Email, strings.Join(a.Roles, ", "))
+	default:
+		return fmt.Sprintf("- revoke %s [%s]", a.Email, strings.Join(a.Roles, ", "))
+	}
+}
+
+// Plan is the ordered list of actions bringing the application to a state.
+type Plan struct {
+	Actions []Action
+}
+
+// Empty reports whether the application already matches the state.
+func (p *Plan) Empty() bool {
+	return len(p.Actions) == 0
+}
+
+// String returns one line per action, or a note that there is nothing to do.
+func (p *Plan) String() string {
+	if p.Empty() {
+		return "No changes.\n"
+	}
+
+	var buffer bytes.Buffer
+	counts := make(map[Kind]int)
+	for _, action := range p.Actions {
+		buffer.WriteString(action.String())
+		buffer.WriteByte('\n')
+		counts[action.Kind]++
+	}
+	fmt.Fprintf(&buffer, "Plan: %d to create, %d to update, %d to grant, %d to revoke.\n",
+		counts[Create], counts[Update], counts[Grant], counts[Revoke])
+	return buffer.String()
+}
+
+// Diff compares the state with the users reported by management.ListUsers and
+// returns the actions needed to reach it, grouped by user in email order.
+func Diff(state *State, manager management.GlobalIdentityManager) (*Plan, error) {
+	users, err := management.ListAllUsers(manager, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	return DiffUsers(state, users), nil
+}
+
+// DiffUsers compares the state with the current users.
+func DiffUsers(state *State, current []core.User) *Plan {
+	existing := make(map[string]core.User, len(current))
+	for _, user := range current {
+		existing[user.Email] = user
+	}
+
+	desired := append([]User(nil), state.Users...)
+	sort.Slice(desired, func(i, j int) bool { return desired[i].Email < desired[j].Email })
+
+	plan := new(Plan)
+	for _, want := range desired {
+		roles := management.UniqueRoles(want.Roles)
+
+		have, found := existing[want.Email]
+		if !found {
+			user := &core.User{Email: want.Email, Name: want.Name, Comment: want.Comment, Active: true, Roles: roles}
+			if want.Active != nil {
+				user.Active = *want.Active
+			}
+			plan.Actions = append(plan.Actions, Action{Kind: Create, Email: want.Email, User: user})
+			continue
+		}
+
+		updated := have
+		updated.Roles = nil
+		if want.Name != "" {
+			updated.Name = want.Name
+		}
+		if want.Comment != "" {
+			updated.Comment = want.Comment
+		}
+		if want.Active != nil {
+			updated.Active = *want.Active
+		}
+		if updated.Name != have.Name || updated.Comment != have.Comment || updated.Active != have.Active {
+			plan.Actions = append(plan.Actions, Action{Kind: Update, Email: want.Email, User: &updated})
+		}
+
+		if want.Roles == nil {
+			continue
+		}
+		granted, revoked := management.DiffRoles(have.Roles, roles)
+		if len(granted) > 0 {
+			plan.Actions = append(plan.Actions, Action{Kind: Grant, Email: want.Email, Roles: granted})
+		}
+		if len(revoked) > 0 {
+			plan.Actions = append(plan.Actions, Action{Kind: Revoke, Email: want.Email, Roles: revoked})
+		}
+	}
+
+	return plan
+}
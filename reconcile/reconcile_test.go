@@ -0,0 +1,129 @@
+package reconcile
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stone-payments/globalidentity-go/management/managementtest"
+	"github.com/stretchr/testify/assert"
+)
+
+const stateYAML = `
+users:
+  - email: a@email.com
+    roles: [USER]
+  - email: b@email.com
+    active: false
+    roles: [ADMIN, USER]
+  - email: c@email.com
+    name: C
+    roles: [FINANCE]
+`
+
+func currentUsers() []core.User {
+	return []core.User{
+		{Email: "a@email.com", Name: "A", Active: true, Roles: []string{"USER"}},
+		{Email: "b@email.com", Name: "B", Active: true, Roles: []string{"ADMIN", "AUDITOR"}},
+		{Email: "z@email.com", Name: "Z", Active: true, Roles: []string{"ADMIN"}},
+	}
+}
+
+func loadState(t *testing.T) *State {
+	state, err := loadStateFile(t, "state.yaml", stateYAML)
+	assert.Nil(t, err)
+	return state
+}
+
+func loadStateFile(t *testing.T, name, content string) (*State, error) {
+	dir, err := ioutil.TempDir("", "reconcile")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, name)
+	assert.Nil(t, ioutil.WriteFile(filename, []byte(content), 0600))
+
+	return LoadState(filename)
+}
+
+func TestStateValidate(t *testing.T) {
+	assert.NotNil(t, (&State{Users: []User{{Name: "nameless"}}}).Validate())
+	assert.NotNil(t, (&State{Users: []User{{Email: "a@email.com"}, {Email: "a@email.com"}}}).Validate())
+}
+
+func TestLoadStateJSON(t *testing.T) {
+	state, err := loadStateFile(t, "state.json", `{"users": [{"email": "a@email.com", "roles": ["USER"]}]}`)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"USER"}, state.Users[0].Roles)
+
+	_, err = loadStateFile(t, "state.json", `{"users": [{"email": "a@email.com", "role": ["USER"]}]}`)
+	assert.NotNil(t, err)
+}
+
+func TestDiffUnmanagedRoles(t *testing.T) {
+	state, err := loadStateFile(t, "state.yaml", `
+users:
+  - email: a@email.com
+    name: Renamed
+  - email: b@email.com
+    roles: []
+`)
+	assert.Nil(t, err)
+
+	plan := DiffUsers(state, currentUsers())
+	assert.Equal(t, `~ update a@email.com (name="Renamed", comment="", active=true)
+- revoke b@email.com [ADMIN, AUDITOR]
+Plan: 0 to create, 1 to update, 0 to grant, 1 to revoke.
+`, plan.String())
+}
+
+func TestDiff(t *testing.T) {
+	manager := managementtest.New(currentUsers()...)
+
+	plan, err := Diff(loadState(t), manager)
+	assert.Nil(t, err)
+
+	assert.Equal(t, `~ update b@email.com (name="B", comment="", active=false)
++ grant b@email.com [USER]
+- revoke b@email.com [AUDITOR]
++ create c@email.com (name="C", active=true, roles=[FINANCE])
+Plan: 1 to create, 1 to update, 1 to grant, 1 to revoke.
+`, plan.String())
+}
+
+func TestApply(t *testing.T) {
+	manager := managementtest.New(currentUsers()...)
+	plan, _ := Diff(loadState(t), manager)
+
+	report := Apply(plan, manager, Options{Concurrency: 2, DryRun: true})
+	assert.Empty(t, report.Failed())
+	assert.Equal(t, 0, manager.Calls("UpdateUser"))
+
+	report = Apply(plan, manager, Options{Concurrency: 2})
+	assert.Empty(t, report.Failed())
+
+	plan, err := Diff(loadState(t), manager)
+	assert.Nil(t, err)
+	assert.True(t, plan.Empty())
+	assert.Equal(t, "No changes.\n", plan.String())
+
+	user, _ := manager.User("z@email.com", true)
+	assert.Equal(t, []string{"ADMIN"}, user.Roles)
+}
+
+func TestApplySkipsAfterFailure(t *testing.T) {
+	manager := managementtest.New(currentUsers()...)
+	plan, _ := Diff(loadState(t), manager)
+	manager.Fail("UpdateUser", errors.New("unavailable"))
+
+	report := Apply(plan, manager, Options{})
+
+	failed := report.Failed()
+	assert.Len(t, failed, 3)
+	assert.Equal(t, Update, failed[0].Action.Kind)
+	assert.IsType(t, SkippedError{}, failed[1].Err)
+	assert.Nil(t, report.Results[3].Err)
+}
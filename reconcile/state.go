@@ -0,0 +1,70 @@
+// Package reconcile brings the users and roles of a Global Identity
+// application to a desired state described in a file.
+package reconcile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// User is the desired state of a user. Users are matched by email; an empty
+// Name or Comment, a nil Active and nil Roles leave the current value
+// unchanged. An explicit empty Roles list revokes every role.
+type User struct {
+	Email   string   `json:"email" yaml:"email"`
+	Name    string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Comment string   `json:"comment,omitempty" yaml:"comment,omitempty"`
+	Active  *bool    `json:"active,omitempty" yaml:"active,omitempty"`
+	Roles   []string `json:"roles" yaml:"roles"`
+}
+
+// State lists the desired users. Users of the application not listed are
+// left untouched.
+type State struct {
+	Users []User `json:"users" yaml:"users"`
+}
+
+// LoadState reads a state file, decoding it as YAML or JSON based on its
+// extension.
+func LoadState(filename string) (*State, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	state := new(State)
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, state)
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(state)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return state, state.Validate()
+}
+
+// Validate checks that every user has an email and is listed only once.
+func (s *State) Validate() error {
+	seen := make(map[string]bool, len(s.Users))
+	for i, user := range s.Users {
+		if user.Email == "" {
+			return fmt.Errorf("reconcile: user %d has no email", i)
+		}
+		if seen[user.Email] {
+			return fmt.Errorf("reconcile: user %q is listed more than once", user.Email)
+		}
+		seen[user.Email] = true
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Package registry holds Global Identity managers for several applications,
+// or tenants, sharing a single HTTP connection pool.
+package registry
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stone-payments/globalidentity-go/authorization"
+	"github.com/stone-payments/globalidentity-go/management"
+)
+
+// UnknownTenantError is returned when a tenant is not registered.
+type UnknownTenantError string
+
+func (e UnknownTenantError) Error() string {
+	return "registry: unknown tenant " + string(e)
+}
+
+// InvalidTenantError is returned when a tenant cannot be registered or lacks
+// what is needed for the requested manager.
+type InvalidTenantError string
+
+func (e InvalidTenantError) Error() string {
+	return "registry: " + string(e)
+}
+
+// Tenant is a Global Identity application served by the platform. APIKey is
+// only needed for the management manager.
+type Tenant struct {
+	ID             string
+	ApplicationKey string
+	APIKey         string
+	Host           string
+}
+
+type entry struct {
+	tenant        Tenant
+	authorization authorization.Manager
+	management    management.Manager
+}
+
+// Registry holds the managers of every registered tenant. It is safe for
+// concurrent use and tenants can be added and removed at any time.
+type Registry struct {
+	mutex     sync.RWMutex
+	requester core.Requester
+	tenants   map[string]*entry
+}
+
+// New returns an empty registry whose managers send their requests through
+// client. A nil client uses http.DefaultClient.
+func New(client *http.Client) *Registry {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return NewWithRequester(core.NewRequesterWithClient(client))
+}
+
+// NewWithRequester returns an empty registry whose managers share requester.
+func NewWithRequester(requester core.Requester) *Registry {
+	return &Registry{
+		requester: requester,
+		tenants:   make(map[string]*entry),
+	}
+}
+
+// Add registers the tenant, replacing any tenant with the same ID.
+func (r *Registry) Add(tenant Tenant) error {
+	if tenant.ID == "" || tenant.ApplicationKey == "" || tenant.Host == "" {
+		return InvalidTenantError("tenant ID, application key and host are required")
+	}
+
+	e := &entry{
+		tenant:        tenant,
+		authorization: authorization.New(tenant.ApplicationKey, tenant.Host, authorization.WithRequester(r.requester)),
+	}
+	if tenant.APIKey != "" {
+		e.management = management.New(tenant.ApplicationKey, tenant.APIKey, tenant.Host, management.WithRequester(r.requester))
+	}
+
+	r.mutex.Lock()
+	r.tenants[tenant.ID] = e
+	r.mutex.Unlock()
+	return nil
+}
+
+// Remove unregisters the tenant and reports whether it was registered.
+func (r *Registry) Remove(id string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	_, found := r.tenants[id]
+	delete(r.tenants, id)
+	return found
+}
+
+// Tenant returns the registered tenant.
+func (r *Registry) Tenant(id string) (Tenant, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	e, found := r.tenants[id]
+	if !found {
+		return Tenant{}, false
+	}
+	return e.tenant, true
+}
+
+// Tenants returns every registered tenant sorted by ID.
+func (r *Registry) Tenants() []Tenant {
+	r.mutex.RLock()
+	tenants := make([]Tenant, 0, len(r.tenants))
+	for _, e := range r.tenants {
+		tenants = append(tenants, e.tenant)
+	}
+	r.mutex.RUnlock()
+
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].ID < tenants[j].ID })
+	return tenants
+}
+
+// Authorization returns the authorization manager of the tenant.
+func (r *Registry) Authorization(id string) (authorization.Manager, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	e, found := r.tenants[id]
+	if !found {
+		return nil, UnknownTenantError(id)
+	}
+	return e.authorization, nil
+}
+
+// Management returns the management manager of the tenant, which requires
+// the tenant to have an API key.
+func (r *Registry) Management(id string) (management.Manager, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	e, found := r.tenants[id]
+	if !found {
+		return nil, UnknownTenantError(id)
+	}
+	if e.management == nil {
+		return nil, InvalidTenantError("tenant " + id + " has no API key")
+	}
+	return e.management, nil
+}
@@ -0,0 +1,48 @@
+package registry
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	defer leaktest.Check(t)()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", "http://br.gi/api/authorization/validateToken", httpmock.NewStringResponder(http.StatusOK, `{"Success": true, "OperationReport": []}`))
+	httpmock.RegisterResponder("POST", "http://us.gi/api/authorization/validateToken", httpmock.NewStringResponder(http.StatusOK, `{"Success": false, "OperationReport": [{"Message": "invalid"}]}`))
+
+	registry := New(nil)
+	assert.Nil(t, registry.Add(Tenant{ID: "br", ApplicationKey: "br-key", APIKey: "api", Host: "http://br.gi"}))
+	assert.Nil(t, registry.Add(Tenant{ID: "us", ApplicationKey: "us-key", Host: "http://us.gi"}))
+	assert.NotNil(t, registry.Add(Tenant{ID: "invalid"}))
+
+	manager, err := registry.Authorization("br")
+	assert.Nil(t, err)
+	ok, _ := manager.ValidateToken("token")
+	assert.True(t, ok)
+
+	manager, err = registry.Authorization("us")
+	assert.Nil(t, err)
+	ok, _ = manager.ValidateToken("token")
+	assert.False(t, ok)
+
+	_, err = registry.Management("br")
+	assert.Nil(t, err)
+	_, err = registry.Management("us")
+	assert.IsType(t, InvalidTenantError(""), err)
+
+	assert.Equal(t, 2, len(registry.Tenants()))
+	assert.True(t, registry.Remove("us"))
+	assert.False(t, registry.Remove("us"))
+
+	_, err = registry.Authorization("us")
+	assert.Equal(t, UnknownTenantError("us"), err)
+	_, found := registry.Tenant("br")
+	assert.True(t, found)
+}
@@ -1,7 +1,10 @@
 package globalidentity
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
+
 	"github.com/levigross/grequests"
 )
 
@@ -14,14 +17,46 @@ type Requester interface {
 	Get(url string, requestOptions *RequestOptions) (*HttpResponse, error)
 }
 
-type requester struct{}
+// WriteRequester is a Requester also sending the PUT and DELETE requests of
+// the management write operations. It is kept apart from Requester so that
+// existing requesters keep compiling; Put and Delete detect it.
+type WriteRequester interface {
+	Requester
+	Put(url string, requestOptions *RequestOptions) (*HttpResponse, error)
+	Delete(url string, requestOptions *RequestOptions) (*HttpResponse, error)
+}
+
+// ErrUnsupportedMethod is returned by Put and Delete when the requester is
+// not a WriteRequester.
+var ErrUnsupportedMethod = errors.New("globalidentity: requester does not send PUT and DELETE requests")
+
+// Put sends a PUT request through requester when it is a WriteRequester.
+func Put(requester Requester, url string, requestOptions *RequestOptions) (*HttpResponse, error) {
+	if writer, ok := requester.(WriteRequester); ok {
+		return writer.Put(url, requestOptions)
+	}
+	return nil, ErrUnsupportedMethod
+}
+
+// Delete sends a DELETE request through requester when it is a
+// WriteRequester.
+func Delete(requester Requester, url string, requestOptions *RequestOptions) (*HttpResponse, error) {
+	if writer, ok := requester.(WriteRequester); ok {
+		return writer.Delete(url, requestOptions)
+	}
+	return nil, ErrUnsupportedMethod
+}
+
+type requester struct {
+	client *http.Client
+}
 
 type RequestOptions struct {
 	grequests.RequestOptions
 }
 
 func (r requester) Post(url string, ro *RequestOptions) (*HttpResponse, error) {
-	response, err := grequests.Post(url, &ro.RequestOptions)
+	response, err := grequests.Post(url, r.options(ro))
 
 	if err == nil {
 		err = r.processResponse(&HttpResponse{Response: response})
@@ -30,7 +65,27 @@ func (r requester) Post(url string, ro *RequestOptions) (*HttpResponse, error) {
 	return &HttpResponse{Response: response}, err
 }
 func (r requester) Get(url string, ro *RequestOptions) (*HttpResponse, error) {
-	response, err := grequests.Get(url, &ro.RequestOptions)
+	response, err := grequests.Get(url, r.options(ro))
+
+	if err == nil {
+		err = r.processResponse(&HttpResponse{Response: response})
+	}
+
+	return &HttpResponse{Response: response}, err
+}
+
+func (r requester) Put(url string, ro *RequestOptions) (*HttpResponse, error) {
+	response, err := grequests.Put(url, r.options(ro))
+
+	if err == nil {
+		err = r.processResponse(&HttpResponse{Response: response})
+	}
+
+	return &HttpResponse{Response: response}, err
+}
+
+func (r requester) Delete(url string, ro *RequestOptions) (*HttpResponse, error) {
+	response, err := grequests.Delete(url, r.options(ro))
 
 	if err == nil {
 		err = r.processResponse(&HttpResponse{Response: response})
@@ -39,6 +94,13 @@ func (r requester) Get(url string, ro *RequestOptions) (*HttpResponse, error) {
 	return &HttpResponse{Response: response}, err
 }
 
+func (r requester) options(ro *RequestOptions) *grequests.RequestOptions {
+	if r.client != nil && ro.HTTPClient == nil {
+		ro.HTTPClient = r.client
+	}
+	return &ro.RequestOptions
+}
+
 func (r *requester) processResponse(resp *HttpResponse) error {
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
@@ -51,3 +113,9 @@ func (r *requester) processResponse(resp *HttpResponse) error {
 func NewRequester() Requester {
 	return requester{}
 }
+
+// NewRequesterWithClient returns a Requester sending every request through
+// client, so several managers can share its connection pool.
+func NewRequesterWithClient(client *http.Client) Requester {
+	return requester{client: client}
+}
@@ -0,0 +1,38 @@
+package globalidentity
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+type readOnlyRequester struct {
+	Requester
+}
+
+func TestPutAndDeleteRequireWriteRequester(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("PUT", "http://gi/api/test", httpmock.NewStringResponder(http.StatusOK, "{}"))
+	httpmock.RegisterResponder("DELETE", "http://gi/api/test", httpmock.NewStringResponder(http.StatusOK, "{}"))
+
+	resp, err := Put(NewRequester(), "http://gi/api/test", &RequestOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, err = Delete(NewRequester(), "http://gi/api/test", &RequestOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	readOnly := readOnlyRequester{NewRequester()}
+	_, err = Put(readOnly, "http://gi/api/test", &RequestOptions{})
+	assert.Equal(t, ErrUnsupportedMethod, err)
+	_, err = Delete(readOnly, "http://gi/api/test", &RequestOptions{})
+	assert.Equal(t, ErrUnsupportedMethod, err)
+
+	limited := NewRateLimitedRequester(readOnly, nil)
+	_, err = limited.Put("http://gi/api/test", &RequestOptions{})
+	assert.Equal(t, ErrUnsupportedMethod, err)
+}
@@ -0,0 +1,351 @@
+// Package roleexpr parses and evaluates boolean expressions over Global
+// Identity roles, such as "ADMIN || (FINANCE && APPROVER)".
+//
+// Expressions combine role names with "!", "&&", "||" and parentheses, "!"
+// binding tighter than "&&", which binds tighter than "||". Role names may
+// contain letters, digits and the characters "_", "-", "." and ":".
+package roleexpr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Expr is a parsed role expression.
+type Expr struct {
+	root  node
+	roles []string
+}
+
+// Result is the outcome of evaluating an expression. When Allowed is false,
+// Failed holds the clause responsible for the denial.
+type Result struct {
+	Allowed bool
+	Failed  string
+}
+
+// RoleMapper reports which of the roles a user holds. Both
+// authorization.RoleChecker and management.RoleMapper satisfy it, keyed by
+// user key and by email respectively.
+type RoleMapper interface {
+	RoleMap(user string, roles ...string) (map[string]bool, error)
+}
+
+// Parse parses a role expression.
+func Parse(expression string) (*Expr, error) {
+	p := &parser{input: expression}
+	p.next()
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.token.kind != tokenEOF {
+		return nil, p.errorf("unexpected %q", p.token.text)
+	}
+
+	set := make(map[string]bool)
+	root.collect(set)
+	roles := make([]string, 0, len(set))
+	for role := range set {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+
+	return &Expr{root: root, roles: roles}, nil
+}
+
+// MustParse is like Parse but panics when the expression is invalid.
+func MustParse(expression string) *Expr {
+	expr, err := Parse(expression)
+	if err != nil {
+		panic(err)
+	}
+	return expr
+}
+
+// Roles returns the sorted role names referenced by the expression.
+func (e *Expr) Roles() []string {
+	return e.roles
+}
+
+// String returns the expression in its canonical form.
+func (e *Expr) String() string {
+	return e.root.String()
+}
+
+// Evaluate evaluates the expression against the roles held by a user.
+func (e *Expr) Evaluate(roles ...string) Result {
+	held := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		held[role] = true
+	}
+	return e.evaluate(held)
+}
+
+// EvaluateUser fetches the roles referenced by the expression with a single
+// RoleMap call and evaluates the expression against them.
+func (e *Expr) EvaluateUser(mapper RoleMapper, user string) (Result, error) {
+	held, err := mapper.RoleMap(user, e.roles...)
+	if err != nil {
+		return Result{}, err
+	}
+	return e.evaluate(held), nil
+}
+
+func (e *Expr) evaluate(held map[string]bool) Result {
+	ok, failed := e.root.eval(held)
+	if ok {
+		return Result{Allowed: true}
+	}
+	return Result{Failed: failed.String()}
+}
+
+type node interface {
+	eval(held map[string]bool) (bool, node)
+	collect(set map[string]bool)
+	String() string
+}
+
+type roleNode string
+
+func (n roleNode) eval(held map[string]bool) (bool, node) {
+	if held[string(n)] {
+		return true, nil
+	}
+	return false, n
+}
+
+func (n roleNode) collect(set map[string]bool) {
+	set[string(n)] = true
+}
+
+func (n roleNode) String() string {
+	return string(n)
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n notNode) eval(held map[string]bool) (bool, node) {
+	if ok, _ := n.operand.eval(held); ok {
+		return false, n
+	}
+	return true, nil
+}
+
+func (n notNode) collect(set map[string]bool) {
+	n.operand.collect(set)
+}
+
+func (n notNode) String() string {
+	if _, ok := n.operand.(roleNode); ok {
+		return "!" + n.operand.String()
+	}
+	return "!(" + n.operand.String() + ")"
+}
+
+type andNode []node
+
+func (n andNode) eval(held map[string]bool) (bool, node) {
+	for _, operand := range n {
+		if ok, failed := operand.eval(held); !ok {
+			return false, failed
+		}
+	}
+	return true, nil
+}
+
+func (n andNode) collect(set map[string]bool) {
+	for _, operand := range n {
+		operand.collect(set)
+	}
+}
+
+func (n andNode) String() string {
+	parts := make([]string, len(n))
+	for i, operand := range n {
+		if _, ok := operand.(orNode); ok {
+			parts[i] = "(" + operand.String() + ")"
+		} else {
+			parts[i] = operand.String()
+		}
+	}
+	return strings.Join(parts, " && ")
+}
+
+type orNode []node
+
+func (n orNode) eval(held map[string]bool) (bool, node) {
+	for _, operand := range n {
+		if ok, _ := operand.eval(held); ok {
+			return true, nil
+		}
+	}
+	return false, n
+}
+
+func (n orNode) collect(set map[string]bool) {
+	for _, operand := range n {
+		operand.collect(set)
+	}
+}
+
+func (n orNode) String() string {
+	parts := make([]string, len(n))
+	for i, operand := range n {
+		if _, ok := operand.(andNode); ok {
+			parts[i] = "(" + operand.String() + ")"
+		} else {
+			parts[i] = operand.String()
+		}
+	}
+	return strings.Join(parts, " || ")
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenRole
+	tokenNot
+	tokenAnd
+	tokenOr
+	tokenOpen
+	tokenClose
+	tokenInvalid
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type parser struct {
+	input string
+	pos   int
+	token token
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("roleexpr: %s at position %d", fmt.Sprintf(format, args...), p.token.pos)
+}
+
+func (p *parser) next() {
+	for p.pos < len(p.input) && strings.IndexByte(" \t\r\n", p.input[p.pos]) >= 0 {
+		p.pos++
+	}
+
+	start := p.pos
+	if p.pos >= len(p.input) {
+		p.token = token{kind: tokenEOF, pos: start}
+		return
+	}
+
+	switch c := p.input[p.pos]; {
+	case c == '!':
+		p.pos++
+		p.token = token{kind: tokenNot, text: "!", pos: start}
+	case c == '(':
+		p.pos++
+		p.token = token{kind: tokenOpen, text: "(", pos: start}
+	case c == ')':
+		p.pos++
+		p.token = token{kind: tokenClose, text: ")", pos: start}
+	case strings.HasPrefix(p.input[p.pos:], "&&"):
+		p.pos += 2
+		p.token = token{kind: tokenAnd, text: "&&", pos: start}
+	case strings.HasPrefix(p.input[p.pos:], "||"):
+		p.pos += 2
+		p.token = token{kind: tokenOr, text: "||", pos: start}
+	case isRoleChar(c):
+		for p.pos < len(p.input) && isRoleChar(p.input[p.pos]) {
+			p.pos++
+		}
+		p.token = token{kind: tokenRole, text: p.input[start:p.pos], pos: start}
+	default:
+		p.pos++
+		p.token = token{kind: tokenInvalid, text: string(c), pos: start}
+	}
+}
+
+func (p *parser) parseOr() (node, error) {
+	operand, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	operands := orNode{operand}
+	for p.token.kind == tokenOr {
+		p.next()
+		if operand, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+	}
+
+	if len(operands) == 1 {
+		return operands[0], nil
+	}
+	return operands, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	operand, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	operands := andNode{operand}
+	for p.token.kind == tokenAnd {
+		p.next()
+		if operand, err = p.parseUnary(); err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+	}
+
+	if len(operands) == 1 {
+		return operands[0], nil
+	}
+	return operands, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	switch p.token.kind {
+	case tokenNot:
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand}, nil
+	case tokenOpen:
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.token.kind != tokenClose {
+			return nil, p.errorf("expected \")\"")
+		}
+		p.next()
+		return inner, nil
+	case tokenRole:
+		role := roleNode(p.token.text)
+		p.next()
+		return role, nil
+	case tokenEOF:
+		return nil, p.errorf("unexpected end of expression")
+	default:
+		return nil, p.errorf("unexpected %q", p.token.text)
+	}
+}
+
+func isRoleChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '-' || c == '.' || c == ':'
+}
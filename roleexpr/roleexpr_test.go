@@ -0,0 +1,71 @@
+package roleexpr
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mapperMock struct {
+	roles []string
+	calls int
+	err   error
+}
+
+func (m *mapperMock) RoleMap(user string, roles ...string) (map[string]bool, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	held := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		for _, r := range m.roles {
+			held[role] = held[role] || r == role
+		}
+	}
+	return held, nil
+}
+
+func TestParse(t *testing.T) {
+	expr, err := Parse("ADMIN || (FINANCE && APPROVER)")
+	assert.Nil(t, err)
+	assert.Equal(t, "ADMIN || (FINANCE && APPROVER)", expr.String())
+	assert.Equal(t, []string{"ADMIN", "APPROVER", "FINANCE"}, expr.Roles())
+
+	expr, err = Parse("  !BLOCKED&&(a.b || c:d)  ")
+	assert.Nil(t, err)
+	assert.Equal(t, "!BLOCKED && (a.b || c:d)", expr.String())
+
+	for _, invalid := range []string{"", "ADMIN ||", "(ADMIN", "ADMIN)", "ADMIN & FINANCE", "ADMIN FINANCE", "!"} {
+		_, err = Parse(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	expr := MustParse("ADMIN || (FINANCE && APPROVER)")
+
+	assert.Equal(t, Result{Allowed: true}, expr.Evaluate("ADMIN"))
+	assert.Equal(t, Result{Allowed: true}, expr.Evaluate("FINANCE", "APPROVER"))
+	assert.Equal(t, Result{Failed: "ADMIN || (FINANCE && APPROVER)"}, expr.Evaluate("FINANCE"))
+
+	expr = MustParse("OPERATOR && !BLOCKED && (FINANCE || ADMIN)")
+	assert.Equal(t, Result{Failed: "OPERATOR"}, expr.Evaluate("FINANCE"))
+	assert.Equal(t, Result{Failed: "!BLOCKED"}, expr.Evaluate("OPERATOR", "BLOCKED", "ADMIN"))
+	assert.Equal(t, Result{Failed: "FINANCE || ADMIN"}, expr.Evaluate("OPERATOR"))
+	assert.Equal(t, Result{Allowed: true}, expr.Evaluate("OPERATOR", "ADMIN"))
+}
+
+func TestEvaluateUser(t *testing.T) {
+	expr := MustParse("ADMIN || (FINANCE && APPROVER)")
+
+	mapper := &mapperMock{roles: []string{"FINANCE", "APPROVER"}}
+	result, err := expr.EvaluateUser(mapper, "user")
+	assert.Nil(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 1, mapper.calls)
+
+	_, err = expr.EvaluateUser(&mapperMock{err: errors.New("unavailable")}, "user")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,331 @@
+// Package session keeps Global Identity authorizations on the server under
+// opaque session ids, so tokens never reach the browser.
+package session
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stone-payments/globalidentity-go/authorization"
+	"github.com/stone-payments/globalidentity-go/internal/singleflight"
+)
+
+// ErrNotFound is returned for unknown, expired and revoked sessions.
+var ErrNotFound = errors.New("session: not found")
+
+const (
+	defaultExpiration = 15
+	defaultMaxAge     = 24 * time.Hour
+	idSize            = 32
+)
+
+// Session is an authorization stored under an opaque id.
+type Session struct {
+	ID            string             `json:"id"`
+	Authorization core.Authorization `json:"authorization"`
+	CreatedAt     time.Time          `json:"createdAt"`
+	// ExpiresAt is when the token of the session expires, or when the session
+	// reaches MaxAge if that comes first.
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Options configures a Manager.
+type Options struct {
+	// Expiration is the lifetime of renewed tokens, in minutes, and of new
+	// tokens whose lifetime is unknown. It defaults to 15.
+	Expiration int
+	// RenewWindow is how close to its expiry a token is renewed when its
+	// session is used. It defaults to half of Expiration.
+	RenewWindow time.Duration
+	// MaxAge is how long a session lasts after its creation, however often
+	// its token is renewed. It defaults to 24 hours.
+	MaxAge time.Duration
+}
+
+// Manager creates sessions and renews their tokens while they are in use.
+type Manager struct {
+	store   Store
+	manager authorization.GlobalIdentityManager
+	options Options
+	now     func() time.Time
+	flight  *singleflight.Group
+}
+
+// NewManager returns a Manager keeping sessions in store and renewing and
+// revoking their tokens through manager.
+func NewManager(store Store, manager authorization.GlobalIdentityManager, options Options) *Manager {
+	if options.Expiration <= 0 {
+		options.Expiration = defaultExpiration
+	}
+	if options.RenewWindow <= 0 {
+		options.RenewWindow = time.Duration(options.Expiration) * time.Minute / 2
+	}
+	if options.MaxAge <= 0 {
+		options.MaxAge = defaultMaxAge
+	}
+	return &Manager{store: store, manager: manager, options: options, now: time.Now, flight: new(singleflight.Group)}
+}
+
+// Create stores the authorization under a new random session id.
+func (m *Manager) Create(authorization *core.Authorization) (*Session, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	minutes := authorization.TokenExpirationInMinutes
+	if minutes <= 0 {
+		minutes = m.options.Expiration
+	}
+	now := m.now()
+	session := &Session{
+		ID:            id,
+		Authorization: *authorization,
+		CreatedAt:     now,
+	}
+	session.ExpiresAt = m.expiry(session, now.Add(time.Duration(minutes)*time.Minute))
+	if err = m.store.Save(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Get returns the session, renewing its token when it is about to expire.
+// A session whose token expired or was refused on renewal, with a message,
+// 401 or 404, or that reached MaxAge, is deleted. When
+// Global Identity cannot be reached the session is returned unrenewed.
+func (m *Manager) Get(id string) (*Session, error) {
+	session, err := m.store.Load(id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.now()
+	if m.expired(session, now) {
+		m.store.Delete(id)
+		return nil, ErrNotFound
+	}
+	if session.ExpiresAt.Sub(now) > m.options.RenewWindow {
+		return session, nil
+	}
+	return m.renew(session, false)
+}
+
+// Renew renews the token of the session right away. Unlike Get, it fails
+// when Global Identity cannot be reached.
+func (m *Manager) Renew(id string) (*Session, error) {
+	session, err := m.store.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	if m.expired(session, m.now()) {
+		m.store.Delete(id)
+		return nil, ErrNotFound
+	}
+	return m.renew(session, true)
+}
+
+// expiry returns when the session expires given that its token expires at
+// tokenExpiry: renewals never extend it past MaxAge.
+func (m *Manager) expiry(session *Session, tokenExpiry time.Time) time.Time {
+	if deadline := session.CreatedAt.Add(m.options.MaxAge); deadline.Before(tokenExpiry) {
+		return deadline
+	}
+	return tokenExpiry
+}
+
+// expired reports whether the token of the session expired or the session
+// reached MaxAge.
+func (m *Manager) expired(session *Session, now time.Time) bool {
+	return !now.Before(m.expiry(session, session.ExpiresAt))
+}
+
+// renew renews the token of the session. Concurrent renewals of a session
+// share a single call to Global Identity, since renewing invalidates the
+// previous token.
+func (m *Manager) renew(session *Session, strict bool) (*Session, error) {
+	value, err, _ := m.flight.Do(session.ID, func() (interface{}, error) {
+		return m.renewStored(session)
+	})
+	if err == ErrNotFound {
+		return nil, err
+	}
+	if err != nil {
+		if strict {
+			return nil, err
+		}
+		return session, nil
+	}
+	renewed := *value.(*Session)
+	return &renewed, nil
+}
+
+// renewStored renews the token of the stored session, unless it was already
+// renewed since session was loaded.
+func (m *Manager) renewStored(session *Session) (*Session, error) {
+	stored, err := m.store.Load(session.ID)
+	if err != nil {
+		return nil, err
+	}
+	if stored.Authorization.Token != session.Authorization.Token {
+		return stored, nil
+	}
+
+	token, err := m.manager.RenewToken(stored.Authorization.Token)
+	if err != nil {
+		if refused(err) {
+			m.store.Delete(stored.ID)
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	stored.Authorization.Token = token
+	stored.Authorization.TokenExpirationInMinutes = m.options.Expiration
+	stored.ExpiresAt = m.expiry(stored, m.now().Add(time.Duration(m.options.Expiration)*time.Minute))
+	if err = m.store.Save(stored); err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// refused reports whether Global Identity refused to renew the token for
+// good: it answered with a message, 401 or 404. Other statuses, such as 429,
+// leave the session in place.
+func refused(err error) bool {
+	giErr, ok := err.(core.GlobalIdentityError)
+	if !ok {
+		return false
+	}
+	switch giErr.StatusCode() {
+	case 0, http.StatusUnauthorized, http.StatusNotFound:
+		return true
+	}
+	return false
+}
+
+// Sessions lists the sessions of the user, or every session when userKey is
+// empty. Expired sessions are deleted instead of being listed.
+func (m *Manager) Sessions(userKey string) ([]*Session, error) {
+	sessions, err := m.store.List(userKey)
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.now()
+	current := sessions[:0]
+	for _, session := range sessions {
+		if !m.expired(session, now) {
+			current = append(current, session)
+		} else if err = m.store.Delete(session.ID); err != nil {
+			return nil, err
+		}
+	}
+	return current, nil
+}
+
+// Purge deletes every expired session and returns how many were deleted.
+// Sessions that are never used again are only deleted by Purge, so it should
+// be called periodically.
+func (m *Manager) Purge() (int, error) {
+	sessions, err := m.store.List("")
+	if err != nil {
+		return 0, err
+	}
+
+	now := m.now()
+	deleted := 0
+	for _, session := range sessions {
+		if !m.expired(session, now) {
+			continue
+		}
+		if err = m.store.Delete(session.ID); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// Revoke revokes the token of the session, when the server supports it, and
+// deletes the session.
+func (m *Manager) Revoke(id string) error {
+	session, err := m.store.Load(id)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = m.store.Delete(id); err != nil {
+		return err
+	}
+	if _, err = authorization.RevokeToken(m.manager, session.Authorization.Token); err != nil && err != authorization.ErrUnsupported {
+		return err
+	}
+	return nil
+}
+
+// RevokeUser deletes every session of the user and revokes all of its
+// tokens, when the server supports it. It returns the number of sessions
+// deleted.
+func (m *Manager) RevokeUser(userKey string) (int, error) {
+	deleted, err := m.deleteUser(userKey)
+	if err != nil {
+		return deleted, err
+	}
+	if _, err = authorization.RevokeUserTokens(m.manager, userKey); err != nil && err != authorization.ErrUnsupported {
+		return deleted, err
+	}
+	return deleted, nil
+}
+
+// TokenRevoked deletes the sessions holding the token. It lets the Manager
+// be registered with authorization.WithRevocationListener.
+func (m *Manager) TokenRevoked(token string) {
+	sessions, err := m.store.List("")
+	if err != nil {
+		return
+	}
+	for _, session := range sessions {
+		if session.Authorization.Token == token {
+			m.store.Delete(session.ID)
+		}
+	}
+}
+
+// UserTokensRevoked deletes the sessions of the user.
+func (m *Manager) UserTokensRevoked(userKey string) {
+	m.deleteUser(userKey)
+}
+
+func (m *Manager) deleteUser(userKey string) (int, error) {
+	if userKey == "" {
+		return 0, nil
+	}
+	sessions, err := m.store.List(userKey)
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, session := range sessions {
+		if err = m.store.Delete(session.ID); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+func newID() (string, error) {
+	id := make([]byte, idSize)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(id), nil
+}
@@ -0,0 +1,256 @@
+package session
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	core "github.com/stone-payments/globalidentity-go"
+	"github.com/stone-payments/globalidentity-go/authorization"
+	"github.com/stretchr/testify/assert"
+)
+
+type managerMock struct {
+	authorization.GlobalIdentityManager
+	renewErr     error
+	renewals     int
+	revoked      []string
+	revokedUsers []string
+}
+
+func (m *managerMock) RenewToken(token string) (string, error) {
+	if m.renewErr != nil {
+		return "", m.renewErr
+	}
+	m.renewals++
+	return token + "+", nil
+}
+
+func (m *managerMock) RevokeToken(token string) (bool, error) {
+	m.revoked = append(m.revoked, token)
+	return true, nil
+}
+
+func (m *managerMock) RevokeUserTokens(userKey string) (bool, error) {
+	m.revokedUsers = append(m.revokedUsers, userKey)
+	return false, authorization.ErrUnsupported
+}
+
+func testStore(t *testing.T, store Store) {
+	_, err := store.Load("missing")
+	assert.Equal(t, ErrNotFound, err)
+
+	first := &Session{ID: "first", Authorization: core.Authorization{Token: "a", Key: "alice"}}
+	second := &Session{ID: "second", Authorization: core.Authorization{Token: "b", Key: "bob"}}
+	assert.Nil(t, store.Save(first))
+	assert.Nil(t, store.Save(second))
+
+	loaded, err := store.Load("first")
+	assert.Nil(t, err)
+	assert.Equal(t, first, loaded)
+
+	sessions, err := store.List("bob")
+	assert.Nil(t, err)
+	assert.Equal(t, []*Session{second}, sessions)
+
+	sessions, err = store.List("")
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 2)
+
+	assert.Nil(t, store.Delete("first"))
+	assert.Nil(t, store.Delete("first"))
+	_, err = store.Load("first")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sessions")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := NewFileStore(dir)
+	assert.Nil(t, err)
+	testStore(t, store)
+
+	_, err = store.Load("../sessions")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestManager(t *testing.T) {
+	auth := new(managerMock)
+	manager := NewManager(NewMemoryStore(), auth, Options{Expiration: 10})
+	now := time.Unix(0, 0)
+	manager.now = func() time.Time { return now }
+
+	created, err := manager.Create(&core.Authorization{Token: "token", Key: "user", TokenExpirationInMinutes: 20})
+	assert.Nil(t, err)
+	assert.Len(t, created.ID, 43)
+	assert.Equal(t, now.Add(20*time.Minute), created.ExpiresAt)
+
+	now = now.Add(10 * time.Minute)
+	current, err := manager.Get(created.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "token", current.Authorization.Token)
+	assert.Equal(t, 0, auth.renewals)
+
+	now = now.Add(6 * time.Minute)
+	current, err = manager.Get(created.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "token+", current.Authorization.Token)
+	assert.Equal(t, now.Add(10*time.Minute), current.ExpiresAt)
+
+	now = now.Add(8 * time.Minute)
+	auth.renewErr = errors.New("connection refused")
+	current, err = manager.Get(created.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "token+", current.Authorization.Token)
+	_, err = manager.Renew(created.ID)
+	assert.NotNil(t, err)
+
+	auth.renewErr = core.GlobalIdentityError{"429"}
+	current, err = manager.Get(created.ID)
+	assert.Nil(t, err, "a throttled renewal keeps the session")
+	assert.Equal(t, "token+", current.Authorization.Token)
+	_, err = manager.Renew(created.ID)
+	assert.Equal(t, core.GlobalIdentityError{"429"}, err)
+
+	auth.renewErr = core.GlobalIdentityError{"invalid token"}
+	_, err = manager.Get(created.ID)
+	assert.Equal(t, ErrNotFound, err)
+	_, err = manager.Get(created.ID)
+	assert.Equal(t, ErrNotFound, err)
+
+	auth.renewErr = nil
+	expired, _ := manager.Create(&core.Authorization{Token: "old", Key: "user"})
+	now = now.Add(time.Hour)
+	_, err = manager.Get(expired.ID)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestManagerRevoke(t *testing.T) {
+	auth := new(managerMock)
+	manager := NewManager(NewMemoryStore(), auth, Options{})
+
+	first, _ := manager.Create(&core.Authorization{Token: "first", Key: "user"})
+	manager.Create(&core.Authorization{Token: "second", Key: "user"})
+	other, _ := manager.Create(&core.Authorization{Token: "other", Key: "other"})
+
+	assert.Nil(t, manager.Revoke(first.ID))
+	assert.Equal(t, []string{"first"}, auth.revoked)
+	assert.Nil(t, manager.Revoke(first.ID))
+
+	sessions, err := manager.Sessions("user")
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 1)
+
+	deleted, err := manager.RevokeUser("user")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, deleted)
+	assert.Equal(t, []string{"user"}, auth.revokedUsers)
+
+	manager.TokenRevoked("other")
+	_, err = manager.Get(other.ID)
+	assert.Equal(t, ErrNotFound, err)
+
+	manager.UserTokensRevoked("")
+	sessions, _ = manager.Sessions("")
+	assert.Empty(t, sessions)
+}
+
+func TestManagerMaxAge(t *testing.T) {
+	auth := new(managerMock)
+	manager := NewManager(NewMemoryStore(), auth, Options{Expiration: 10, MaxAge: 25 * time.Minute})
+	now := time.Unix(0, 0)
+	manager.now = func() time.Time { return now }
+
+	created, err := manager.Create(&core.Authorization{Token: "token", Key: "user", TokenExpirationInMinutes: 60})
+	assert.Nil(t, err)
+	assert.Equal(t, now.Add(25*time.Minute), created.ExpiresAt)
+
+	now = now.Add(20 * time.Minute)
+	current, err := manager.Renew(created.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "token+", current.Authorization.Token)
+	assert.Equal(t, created.ExpiresAt, current.ExpiresAt, "renewals do not extend a session past MaxAge")
+
+	now = now.Add(5 * time.Minute)
+	_, err = manager.Get(created.ID)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestManagerPurge(t *testing.T) {
+	store := NewMemoryStore()
+	manager := NewManager(store, new(managerMock), Options{})
+	now := time.Unix(0, 0)
+	manager.now = func() time.Time { return now }
+
+	manager.Create(&core.Authorization{Token: "short", Key: "user", TokenExpirationInMinutes: 5})
+	long, _ := manager.Create(&core.Authorization{Token: "long", Key: "user", TokenExpirationInMinutes: 60})
+	manager.Create(&core.Authorization{Token: "other", Key: "other", TokenExpirationInMinutes: 5})
+
+	now = now.Add(10 * time.Minute)
+	sessions, err := manager.Sessions("user")
+	assert.Nil(t, err)
+	assert.Equal(t, []*Session{long}, sessions, "expired sessions are not listed")
+	stored, _ := store.List("user")
+	assert.Len(t, stored, 1, "expired sessions are deleted when listed")
+
+	deleted, err := manager.Purge()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, deleted)
+	stored, _ = store.List("")
+	assert.Equal(t, []*Session{long}, stored)
+}
+
+type blockingManager struct {
+	authorization.GlobalIdentityManager
+	release  chan struct{}
+	mutex    sync.Mutex
+	renewals int
+}
+
+func (m *blockingManager) RenewToken(token string) (string, error) {
+	<-m.release
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.renewals++
+	if token != "token" {
+		return "", core.GlobalIdentityError{"401"}
+	}
+	return "renewed", nil
+}
+
+func TestManagerConcurrentRenewals(t *testing.T) {
+	auth := &blockingManager{release: make(chan struct{})}
+	manager := NewManager(NewMemoryStore(), auth, Options{})
+	created, _ := manager.Create(&core.Authorization{Token: "token", Key: "user"})
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 4)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if renewed, err := manager.Renew(created.ID); err == nil {
+				tokens[i] = renewed.Authorization.Token
+			}
+		}(i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(auth.release)
+	wg.Wait()
+
+	assert.Equal(t, []string{"renewed", "renewed", "renewed", "renewed"}, tokens)
+
+	renewed, err := manager.renew(created, true)
+	assert.Nil(t, err, "a session loaded before a renewal is not renewed again")
+	assert.Equal(t, "renewed", renewed.Authorization.Token)
+	assert.Equal(t, 1, auth.renewals)
+}
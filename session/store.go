@@ -0,0 +1,189 @@
+package session
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Store persists sessions. Implementations must be safe for concurrent use.
+type Store interface {
+	Save(session *Session) error
+	// Load returns ErrNotFound when there is no session with the id.
+	Load(id string) (*Session, error)
+	// Delete succeeds when there is no session with the id.
+	Delete(id string) error
+	// List returns the sessions of the user, or every session when userKey
+	// is empty.
+	List(userKey string) ([]*Session, error)
+}
+
+type memoryStore struct {
+	mutex    sync.Mutex
+	sessions map[string]Session
+}
+
+// NewMemoryStore returns a Store keeping sessions in memory, for a single
+// instance.
+func NewMemoryStore() Store {
+	return &memoryStore{sessions: make(map[string]Session)}
+}
+
+func (s *memoryStore) Save(session *Session) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sessions[session.ID] = *session
+	return nil
+}
+
+func (s *memoryStore) Load(id string) (*Session, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	session, found := s.sessions[id]
+	if !found {
+		return nil, ErrNotFound
+	}
+	return &session, nil
+}
+
+func (s *memoryStore) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *memoryStore) List(userKey string) ([]*Session, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var sessions []*Session
+	for _, session := range s.sessions {
+		if userKey == "" || session.Authorization.Key == userKey {
+			session := session
+			sessions = append(sessions, &session)
+		}
+	}
+	return sessions, nil
+}
+
+const sessionExtension = ".json"
+
+type fileStore struct {
+	dir   string
+	mutex sync.Mutex
+}
+
+// NewFileStore returns a Store keeping each session as a JSON file in dir,
+// readable only by the current user, so sessions survive restarts and can
+// be shared by processes on the same host.
+func NewFileStore(dir string) (Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &fileStore{dir: dir}, nil
+}
+
+func (s *fileStore) filename(id string) string {
+	return filepath.Join(s.dir, id+sessionExtension)
+}
+
+func (s *fileStore) Save(session *Session) error {
+	if !validID(session.ID) {
+		return ErrNotFound
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	temp, err := ioutil.TempFile(s.dir, ".session")
+	if err != nil {
+		return err
+	}
+	if _, err = temp.Write(data); err == nil {
+		err = temp.Close()
+	} else {
+		temp.Close()
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	return os.Rename(temp.Name(), s.filename(session.ID))
+}
+
+func (s *fileStore) Load(id string) (*Session, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+	data, err := ioutil.ReadFile(s.filename(id))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session := new(Session)
+	if err = json.Unmarshal(data, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *fileStore) Delete(id string) error {
+	if !validID(id) {
+		return nil
+	}
+	err := os.Remove(s.filename(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *fileStore) List(userKey string) ([]*Session, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*Session
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, sessionExtension) {
+			continue
+		}
+		session, err := s.Load(strings.TrimSuffix(name, sessionExtension))
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if userKey == "" || session.Authorization.Key == userKey {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+// validID reports whether id can be a session id, so ids read from cookies
+// cannot name files outside the store.
+func validID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}